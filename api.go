@@ -20,11 +20,25 @@ type DeparturesResponse struct {
 
 // StatusResponse defines the object returned by the /status endpoint
 type StatusResponse struct {
-	Status              string    `json:"status,omitempty"`
-	Version             string    `json:"version,omitempty"`
-	LastDepartureUpdate time.Time `json:"last_departure_update"`
-	LastParkingUpdate   time.Time `json:"last_parking_update"`
-	LastEquipmentUpdate time.Time `json:"last_equipment_update"`
+	Status              string                `json:"status,omitempty"`
+	Version             string                `json:"version,omitempty"`
+	LastDepartureUpdate time.Time             `json:"last_departure_update"`
+	LastParkingUpdate   time.Time             `json:"last_parking_update"`
+	LastEquipmentUpdate time.Time             `json:"last_equipment_update"`
+	LastDepartureCheck  time.Time             `json:"last_departure_check"`
+	LastParkingCheck    time.Time             `json:"last_parking_check"`
+	LastEquipmentCheck  time.Time             `json:"last_equipment_check"`
+	Feeds               map[string]FeedStatus `json:"feeds,omitempty"`
+}
+
+// FeedStatus describes how the refresh of a feed is going
+type FeedStatus struct {
+	// Source is the mirror that served the dataset currently loaded
+	Source  string         `json:"source,omitempty"`
+	Mirrors []MirrorStatus `json:"mirrors,omitempty"`
+	Breaker *BreakerStatus `json:"breaker,omitempty"`
+	// SanityRejection is why the last dataset has been rejected, while the previous one is served
+	SanityRejection *SanityRejection `json:"sanity_rejection,omitempty"`
 }
 
 // ParkingResponse defines how a parking object is represent in a response
@@ -67,6 +81,17 @@ type EquipmentsResponse struct {
 	Error      string            `json:"errors,omitempty"`
 }
 
+// ArchivesResponse defines the structure returned by the /admin/archives endpoint
+type ArchivesResponse struct {
+	Archives map[string][]ArchivedFile `json:"archives"`
+	Error    string                    `json:"error,omitempty"`
+}
+
+// RejectionsResponse defines the structure returned by the /admin/rejections endpoint
+type RejectionsResponse struct {
+	Rejections map[string]*RejectionReport `json:"rejections"`
+}
+
 var (
 	httpDurations = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: "sytralrt",
@@ -116,11 +141,15 @@ func DeparturesHandler(manager *DataManager) gin.HandlerFunc {
 func StatusHandler(manager *DataManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.JSON(http.StatusOK, StatusResponse{
-			"ok",
-			SytralRTVersion,
-			manager.GetLastDepartureDataUpdate(),
-			manager.GetLastParkingsDataUpdate(),
-			manager.GetLastEquipmentsDataUpdate(),
+			Status:              "ok",
+			Version:             SytralRTVersion,
+			LastDepartureUpdate: manager.GetLastDepartureDataUpdate(),
+			LastParkingUpdate:   manager.GetLastParkingsDataUpdate(),
+			LastEquipmentUpdate: manager.GetLastEquipmentsDataUpdate(),
+			LastDepartureCheck:  manager.GetLastDepartureDataCheck(),
+			LastParkingCheck:    manager.GetLastParkingsDataCheck(),
+			LastEquipmentCheck:  manager.GetLastEquipmentsDataCheck(),
+			Feeds:               manager.GetFeedsStatus(),
 		})
 	}
 }
@@ -175,6 +204,25 @@ func EquipmentsHandler(manager *DataManager) gin.HandlerFunc {
 	}
 }
 
+// RejectionsHandler returns the records rejected by the last lenient load of each feed
+func RejectionsHandler(manager *DataManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, RejectionsResponse{Rejections: manager.GetRejections()})
+	}
+}
+
+// ArchivesHandler lists the files archived for each feed, the newest first
+func ArchivesHandler(manager *DataManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		archives, err := manager.GetArchives()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ArchivesResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, ArchivesResponse{Archives: archives})
+	}
+}
+
 func SetupRouter(manager *DataManager, r *gin.Engine) *gin.Engine {
 	if r == nil {
 		r = gin.New()
@@ -192,6 +240,17 @@ func SetupRouter(manager *DataManager, r *gin.Engine) *gin.Engine {
 	return r
 }
 
+// SetupAdminRoutes adds the /admin endpoints, authenticated by one of the bearer tokens,
+// unless no token is configured
+func SetupAdminRoutes(manager *DataManager, r *gin.Engine, tokens []string) {
+	if len(tokens) == 0 {
+		return
+	}
+	admin := r.Group("/admin", requireToken(tokens))
+	admin.GET("/archives", ArchivesHandler(manager))
+	admin.GET("/rejections", RejectionsHandler(manager))
+}
+
 func instrumentGin() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		begin := time.Now()
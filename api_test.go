@@ -208,6 +208,39 @@ func TestStatusApiHasLastParkingUpdateTime(t *testing.T) {
 	assert.True(response.LastParkingUpdate.Before(time.Now()))
 }
 
+func TestStatusApiHasBreakers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var manager DataManager
+	c, engine := gin.CreateTestContext(httptest.NewRecorder())
+	engine = SetupRouter(&manager, engine)
+
+	c.Request = httptest.NewRequest("GET", "/status", nil)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, c.Request)
+	require.Equal(200, w.Code)
+	assert.NotContains(w.Body.String(), "feeds")
+
+	breaker := NewCircuitBreaker("departures", RetryOptions{FailureThreshold: 1, OpenDuration: time.Minute})
+	manager.SetBreaker("departures", breaker)
+	manager.SetBreaker("parkings", NewCircuitBreaker("parkings", RetryOptions{}))
+	breaker.Report(fmt.Errorf("connection refused"))
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, c.Request)
+	require.Equal(200, w.Code)
+	var response StatusResponse
+	require.Nil(json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(response.Feeds, 2)
+	require.NotNil(response.Feeds["departures"].Breaker)
+	assert.Equal(BreakerOpen, response.Feeds["departures"].Breaker.State)
+	assert.Equal(1, response.Feeds["departures"].Breaker.ConsecutiveFailures)
+	assert.Equal("connection refused", response.Feeds["departures"].Breaker.LastError)
+	assert.NotNil(response.Feeds["departures"].Breaker.OpenedAt)
+	assert.Equal(BreakerClosed, response.Feeds["parkings"].Breaker.State)
+}
+
 func TestParkingsPRAPI(t *testing.T) {
 	require := require.New(t)
 	assert := assert.New(t)
@@ -0,0 +1,176 @@
+package sytralrt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ArchiveOptions defines where and for how long the fetched files of a feed are kept
+type ArchiveOptions struct {
+	Dir string // nothing is archived if empty
+
+	// The oldest files are removed once one of these limits is exceeded, the newest file is always kept.
+	// A limit of 0 is ignored.
+	MaxCount     int
+	MaxAge       time.Duration
+	MaxTotalSize int64
+}
+
+// ArchivedFile describes a file of an archive directory
+type ArchivedFile struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ArchivedAt time.Time `json:"archived_at"`
+	Hash       string    `json:"hash"` // beginning of the SHA-256 of the content
+}
+
+// archived files are named after the time they have been fetched, their hash and the name of the source file
+var archiveNamePattern = regexp.MustCompile(`^(\d{8}T\d{6}Z)_([0-9a-f]{16})_(.+)$`)
+
+const archiveTimeLayout = "20060102T150405Z"
+
+// ListArchive returns the files of an archive directory, the newest first
+func ListArchive(dir string) ([]ArchivedFile, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []ArchivedFile
+	for _, info := range infos {
+		parts := archiveNamePattern.FindStringSubmatch(info.Name())
+		if info.IsDir() || parts == nil {
+			continue
+		}
+		archivedAt, err := time.Parse(archiveTimeLayout, parts[1])
+		if err != nil {
+			continue
+		}
+		files = append(files, ArchivedFile{Name: info.Name(), Size: info.Size(), ArchivedAt: archivedAt, Hash: parts[2]})
+	}
+	// the names begin with the time, the newest file is the greatest name
+	sort.Slice(files, func(i, j int) bool { return files[i].Name > files[j].Name })
+	return files, nil
+}
+
+// pruneArchive removes the files exceeding the retention limits of an archive
+func pruneArchive(options ArchiveOptions, now time.Time) error {
+	files, err := ListArchive(options.Dir)
+	if err != nil {
+		return err
+	}
+	var totalSize int64
+	for i, file := range files {
+		totalSize += file.Size
+		if i == 0 ||
+			(options.MaxCount <= 0 || i < options.MaxCount) &&
+				(options.MaxAge <= 0 || now.Sub(file.ArchivedAt) <= options.MaxAge) &&
+				(options.MaxTotalSize <= 0 || totalSize <= options.MaxTotalSize) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(options.Dir, file.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archivingReader copies what is read from a fetched file to a temporary file of the archive directory.
+// The copy is archived once the whole file has been read: when it is closed early, the rest of the file is read first.
+// Failing to archive a file doesn't fail its load.
+type archivingReader struct {
+	file    io.Closer
+	reader  io.Reader
+	name    string // name of the source file
+	options ArchiveOptions
+
+	tmp      *os.File
+	hash     hash.Hash
+	eof      bool
+	readErr  error
+	writeErr error
+}
+
+func newArchivingReader(file io.Closer, reader io.Reader, uri string,
+	options ArchiveOptions) (*archivingReader, error) {
+	if err := os.MkdirAll(options.Dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(options.Dir, ".fetching-")
+	if err != nil {
+		return nil, err
+	}
+	return &archivingReader{
+		file:    file,
+		reader:  reader,
+		name:    path.Base(uri),
+		options: options,
+		tmp:     tmp,
+		hash:    sha256.New(),
+	}, nil
+}
+
+func (r *archivingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 && r.writeErr == nil {
+		r.hash.Write(p[:n]) //nolint:errcheck
+		_, r.writeErr = r.tmp.Write(p[:n])
+	}
+	if err == io.EOF {
+		r.eof = true
+	} else if err != nil {
+		r.readErr = err
+	}
+	return n, err
+}
+
+func (r *archivingReader) Close() error {
+	if !r.eof && r.readErr == nil && r.writeErr == nil {
+		io.Copy(ioutil.Discard, r) //nolint:errcheck
+	}
+	err := r.file.Close()
+
+	if closeErr := r.tmp.Close(); r.writeErr == nil {
+		r.writeErr = closeErr
+	}
+	if !r.eof || r.writeErr != nil {
+		if r.writeErr != nil {
+			logrus.Warnf("unable to archive %s: %s", r.name, r.writeErr)
+		}
+		os.Remove(r.tmp.Name())
+		return err
+	}
+	if archiveErr := r.archive(time.Now()); archiveErr != nil {
+		logrus.Warnf("unable to archive %s: %s", r.name, archiveErr)
+		os.Remove(r.tmp.Name())
+	}
+	return err
+}
+
+// archive renames the temporary copy, unless it is the same as the last archived file
+func (r *archivingReader) archive(now time.Time) error {
+	hash := hex.EncodeToString(r.hash.Sum(nil))[:16]
+	files, err := ListArchive(r.options.Dir)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 && files[0].Hash == hash {
+		return os.Remove(r.tmp.Name())
+	}
+	name := fmt.Sprintf("%s_%s_%s", now.UTC().Format(archiveTimeLayout), hash, r.name)
+	if err := os.Rename(r.tmp.Name(), filepath.Join(r.options.Dir, name)); err != nil {
+		return err
+	}
+	return pruneArchive(r.options, now)
+}
@@ -0,0 +1,180 @@
+package sytralrt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshArchivesFetchedFiles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "sytralrt-archive")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "departures.txt")
+	uri, err := url.Parse(fmt.Sprintf("file://%s", path))
+	require.Nil(err)
+	options := defaultOptions
+	options.Archive.Dir = filepath.Join(dir, "archive")
+
+	var manager DataManager
+	copyFixture(t, "first.txt", path, time.Now().Add(-time.Hour))
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+	files, err := ListArchive(options.Archive.Dir)
+	require.Nil(err)
+	require.Len(files, 1)
+	assert.Regexp(`^\d{8}T\d{6}Z_[0-9a-f]{16}_departures\.txt$`, files[0].Name)
+	archived, err := ioutil.ReadFile(filepath.Join(options.Archive.Dir, files[0].Name))
+	require.Nil(err)
+	expected, err := ioutil.ReadFile(path)
+	require.Nil(err)
+	assert.Equal(string(expected), string(archived))
+	assert.Equal(int64(len(expected)), files[0].Size)
+
+	// the same content isn't archived twice
+	copyFixture(t, "first.txt", path, time.Now())
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+	files, err = ListArchive(options.Archive.Dir)
+	require.Nil(err)
+	assert.Len(files, 1)
+
+	// a file that can't be parsed is archived as well
+	copyFixture(t, "invaliddate.txt", path, time.Now().Add(time.Hour))
+	assert.Error(RefreshDeparturesWithOptions(&manager, *uri, options))
+	files, err = ListArchive(options.Archive.Dir)
+	require.Nil(err)
+	assert.Len(files, 2)
+
+	// nothing but the archived files are left in the directory
+	entries, err := ioutil.ReadDir(options.Archive.Dir)
+	require.Nil(err)
+	assert.Len(entries, 2)
+}
+
+func TestArchiveFileClosedBeforeTheEnd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sytralrt-archive")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	uri, err := url.Parse(fmt.Sprintf("file://%s/first.txt.gz", fixtureDir))
+	require.Nil(t, err)
+	options := defaultOptions
+	options.Archive.Dir = dir
+
+	file, err := getFile(*uri, options)
+	require.Nil(t, err)
+	require.Nil(t, file.Close())
+
+	// the file is archived whole and compressed, as it has been served
+	files, err := ListArchive(dir)
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	archived, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name))
+	require.Nil(t, err)
+	expected, err := ioutil.ReadFile(uri.Path)
+	require.Nil(t, err)
+	assert.Equal(t, expected, archived)
+}
+
+func TestPruneArchive(t *testing.T) {
+	now := time.Date(2018, 10, 17, 12, 0, 0, 0, time.UTC)
+	newArchive := func(t *testing.T) string {
+		dir, err := ioutil.TempDir("", "sytralrt-archive")
+		require.Nil(t, err)
+		for i := 0; i < 5; i++ {
+			name := fmt.Sprintf("%s_%016x_departures.txt", now.Add(-time.Duration(i)*time.Hour).Format(archiveTimeLayout), i)
+			require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), make([]byte, 100), 0600))
+		}
+		// files that aren't archives are left alone
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "README"), nil, 0600))
+		return dir
+	}
+	remaining := func(t *testing.T, dir string) []string {
+		files, err := ListArchive(dir)
+		require.Nil(t, err)
+		var hashes []string
+		for _, file := range files {
+			hashes = append(hashes, file.Hash)
+		}
+		return hashes
+	}
+
+	tests := []struct {
+		name     string
+		options  ArchiveOptions
+		expected []string
+	}{
+		{"no limit", ArchiveOptions{}, []string{
+			"0000000000000000", "0000000000000001", "0000000000000002", "0000000000000003", "0000000000000004"}},
+		{"count", ArchiveOptions{MaxCount: 2}, []string{"0000000000000000", "0000000000000001"}},
+		{"age", ArchiveOptions{MaxAge: 150 * time.Minute}, []string{
+			"0000000000000000", "0000000000000001", "0000000000000002"}},
+		{"total size", ArchiveOptions{MaxTotalSize: 250}, []string{"0000000000000000", "0000000000000001"}},
+		{"newest is kept", ArchiveOptions{MaxTotalSize: 10, MaxAge: time.Nanosecond}, []string{"0000000000000000"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := newArchive(t)
+			defer os.RemoveAll(dir)
+			test.options.Dir = dir
+			require.Nil(t, pruneArchive(test.options, now.Add(time.Minute)))
+			assert.Equal(t, test.expected, remaining(t, dir))
+			_, err := os.Stat(filepath.Join(dir, "README"))
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestArchivesApi(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "sytralrt-archive")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	uri, err := url.Parse(fmt.Sprintf("file://%s/first.txt", fixtureDir))
+	require.Nil(err)
+	options := defaultOptions
+	options.Archive.Dir = filepath.Join(dir, "departures")
+
+	var manager DataManager
+	c, engine := gin.CreateTestContext(httptest.NewRecorder())
+	engine = SetupRouter(&manager, engine)
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+	// a feed without archive directory isn't listed
+	parkingsURI, err := url.Parse(fmt.Sprintf("file://%s/parkings.txt", fixtureDir))
+	require.Nil(err)
+	require.Nil(RefreshParkingsWithOptions(&manager, *parkingsURI, defaultOptions))
+
+	SetupAdminRoutes(&manager, engine, []string{"secret"})
+
+	// the archives are only listed to the holders of an admin token
+	c.Request = httptest.NewRequest("GET", "/admin/archives", nil)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, c.Request)
+	require.Equal(http.StatusUnauthorized, w.Code)
+
+	c.Request = httptest.NewRequest("GET", "/admin/archives", nil)
+	c.Request.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, c.Request)
+	require.Equal(200, w.Code)
+	var response ArchivesResponse
+	require.Nil(json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(response.Archives, 1)
+	require.Len(response.Archives["departures"], 1)
+	assert.Regexp(`_first\.txt$`, response.Archives["departures"][0].Name)
+	assert.NotZero(response.Archives["departures"][0].Size)
+}
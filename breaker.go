@@ -0,0 +1,223 @@
+package sytralrt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	breakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sytralrt",
+		Subsystem: "breaker",
+		Name:      "state",
+		Help:      "state of the circuit breaker of a feed: 0 closed, 1 open, 2 half-open",
+	},
+		[]string{"feed"},
+	)
+
+	breakerOpenings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sytralrt",
+		Subsystem: "breaker",
+		Name:      "openings",
+		Help:      "number of times the circuit breaker of a feed has been opened",
+	},
+		[]string{"feed"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(breakerState)
+	prometheus.MustRegister(breakerOpenings)
+}
+
+// BreakerState is the state of the circuit breaker of a feed
+type BreakerState int
+
+const (
+	// BreakerClosed lets every refresh through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen stops the refreshes of a source that failed too many times in a row
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe through to know if the source has recovered
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	return [...]string{"closed", "open", "half-open"}[s]
+}
+
+// MarshalJSON marshals the enum as a quoted json string
+func (s BreakerState) MarshalJSON() ([]byte, error) {
+	buffer := bytes.NewBufferString(`"`)
+	buffer.WriteString(s.String())
+	buffer.WriteString(`"`)
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalJSON unmarshals a quoted json string to the enum value
+func (s *BreakerState) UnmarshalJSON(b []byte) error {
+	var j string
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	*s, err = ParseBreakerState(j)
+	return err
+}
+
+func ParseBreakerState(value string) (BreakerState, error) {
+	switch value {
+	case "closed":
+		return BreakerClosed, nil
+	case "open":
+		return BreakerOpen, nil
+	case "half-open":
+		return BreakerHalfOpen, nil
+	default:
+		return BreakerClosed, fmt.Errorf("impossible to parse %s", value)
+	}
+}
+
+// RetryOptions defines how the refreshes of a failing source are spaced out
+type RetryOptions struct {
+	// After a failure the next refresh is delayed by twice the refresh interval,
+	// this delay doubles at each consecutive failure up to MaxBackoff.
+	// There is no backoff if MaxBackoff isn't greater than the refresh interval.
+	MaxBackoff time.Duration
+	// Jitter randomly spreads the delays after a failure by ± this fraction (0.2 means ±20%)
+	Jitter float64
+	// FailureThreshold is the number of consecutive failures opening the breaker, 0 never opens it
+	FailureThreshold int
+	// OpenDuration is the time an open breaker waits before letting a probe through
+	OpenDuration time.Duration
+}
+
+// BreakerStatus is the state of a circuit breaker as exposed by /status
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastError           string       `json:"last_error,omitempty"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+}
+
+// CircuitBreaker tracks the consecutive failures of a source to back off its refreshes,
+// and stops them altogether while the source looks down
+type CircuitBreaker struct {
+	feed    string
+	options RetryOptions
+
+	mutex     sync.Mutex
+	state     BreakerState
+	failures  int
+	lastError string
+	openedAt  time.Time
+
+	now    func() time.Time
+	random func() float64
+}
+
+// NewCircuitBreaker creates a closed breaker, feed names it in the logs and the metrics
+func NewCircuitBreaker(feed string, options RetryOptions) *CircuitBreaker {
+	breakerState.WithLabelValues(feed).Set(float64(BreakerClosed))
+	return &CircuitBreaker{
+		feed:    feed,
+		options: options,
+		now:     time.Now,
+		random:  rand.Float64,
+	}
+}
+
+func (b *CircuitBreaker) setState(state BreakerState) {
+	b.state = state
+	breakerState.WithLabelValues(b.feed).Set(float64(state))
+}
+
+// Allow tells if the source can be fetched now.
+// An open breaker becomes half-open and lets a probe through once its OpenDuration is elapsed.
+func (b *CircuitBreaker) Allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == BreakerOpen {
+		if b.now().Sub(b.openedAt) < b.options.OpenDuration {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	return true
+}
+
+// Report records the result of a refresh
+func (b *CircuitBreaker) Report(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil {
+		if b.state != BreakerClosed {
+			logrus.Infof("%s source has recovered, closing the circuit breaker", b.feed)
+			b.setState(BreakerClosed)
+		}
+		b.failures = 0
+		b.lastError = ""
+		return
+	}
+
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == BreakerHalfOpen ||
+		(b.state == BreakerClosed && b.options.FailureThreshold > 0 && b.failures >= b.options.FailureThreshold) {
+		logrus.Warnf("%s source failed %d times in a row, opening the circuit breaker for %s",
+			b.feed, b.failures, b.options.OpenDuration)
+		b.setState(BreakerOpen)
+		b.openedAt = b.now()
+		breakerOpenings.WithLabelValues(b.feed).Inc()
+	}
+}
+
+// Delay returns the time to wait before the next refresh of a source normally refreshed every refresh
+func (b *CircuitBreaker) Delay(refresh time.Duration) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var delay time.Duration
+	switch {
+	case b.state == BreakerOpen:
+		delay = b.options.OpenDuration - b.now().Sub(b.openedAt)
+	case b.failures == 0:
+		return refresh
+	default:
+		delay = refresh
+		for i := 0; i < b.failures && delay < b.options.MaxBackoff; i++ {
+			delay *= 2
+		}
+		if delay > b.options.MaxBackoff && b.options.MaxBackoff > refresh {
+			delay = b.options.MaxBackoff
+		}
+	}
+	// the jitter keeps the feeds sharing a server from retrying in lockstep
+	delay += time.Duration(float64(delay) * b.options.Jitter * (2*b.random() - 1))
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// Status returns the current state of the breaker
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
@@ -0,0 +1,109 @@
+package sytralrt
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBreaker returns a breaker without jitter and whose clock is moved by hand
+func newTestBreaker(options RetryOptions) (*CircuitBreaker, *time.Time) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker("test", options)
+	breaker.now = func() time.Time { return now }
+	breaker.random = func() float64 { return 0.5 }
+	return breaker, &now
+}
+
+func TestBreakerBackoff(t *testing.T) {
+	assert := assert.New(t)
+	breaker, _ := newTestBreaker(RetryOptions{MaxBackoff: 10 * time.Second})
+	refresh := time.Second
+	failure := errors.New("connection refused")
+
+	assert.Equal(refresh, breaker.Delay(refresh))
+	for _, expected := range []time.Duration{2, 4, 8, 10, 10} {
+		breaker.Report(failure)
+		assert.True(breaker.Allow())
+		assert.Equal(expected*time.Second, breaker.Delay(refresh))
+	}
+	assert.Equal(BreakerStatus{State: BreakerClosed, ConsecutiveFailures: 5, LastError: "connection refused"},
+		breaker.Status())
+
+	breaker.Report(nil)
+	assert.Equal(refresh, breaker.Delay(refresh))
+	assert.Equal(BreakerStatus{State: BreakerClosed}, breaker.Status())
+
+	// no backoff if the maximum isn't greater than the refresh interval
+	breaker, _ = newTestBreaker(RetryOptions{})
+	breaker.Report(failure)
+	breaker.Report(failure)
+	assert.Equal(refresh, breaker.Delay(refresh))
+}
+
+func TestBreakerJitter(t *testing.T) {
+	breaker, _ := newTestBreaker(RetryOptions{MaxBackoff: time.Minute, Jitter: 0.2})
+	breaker.Report(errors.New("connection refused"))
+
+	breaker.random = func() float64 { return 0 }
+	assert.Equal(t, 1600*time.Millisecond, breaker.Delay(time.Second))
+	breaker.random = func() float64 { return 1 }
+	assert.Equal(t, 2400*time.Millisecond, breaker.Delay(time.Second))
+}
+
+func TestBreakerOpens(t *testing.T) {
+	assert := assert.New(t)
+	breaker, now := newTestBreaker(RetryOptions{MaxBackoff: time.Minute, FailureThreshold: 3, OpenDuration: time.Minute})
+	failure := errors.New("connection refused")
+
+	breaker.Report(failure)
+	breaker.Report(failure)
+	assert.Equal(BreakerClosed, breaker.Status().State)
+	breaker.Report(failure)
+	status := breaker.Status()
+	assert.Equal(BreakerOpen, status.State)
+	require.NotNil(t, status.OpenedAt)
+	assert.Equal(*now, *status.OpenedAt)
+	assert.False(breaker.Allow())
+	assert.Equal(time.Minute, breaker.Delay(time.Second))
+
+	*now = now.Add(40 * time.Second)
+	assert.False(breaker.Allow())
+	assert.Equal(20*time.Second, breaker.Delay(time.Second))
+
+	// a failed probe opens the breaker again
+	*now = now.Add(20 * time.Second)
+	assert.True(breaker.Allow())
+	assert.Equal(BreakerHalfOpen, breaker.Status().State)
+	breaker.Report(failure)
+	assert.Equal(BreakerOpen, breaker.Status().State)
+	assert.False(breaker.Allow())
+
+	// a successful one closes it
+	*now = now.Add(time.Minute)
+	assert.True(breaker.Allow())
+	breaker.Report(nil)
+	assert.Equal(BreakerStatus{State: BreakerClosed}, breaker.Status())
+	assert.True(breaker.Allow())
+	assert.Equal(time.Second, breaker.Delay(time.Second))
+}
+
+func TestBreakerStateJSON(t *testing.T) {
+	for _, state := range []BreakerState{BreakerClosed, BreakerOpen, BreakerHalfOpen} {
+		b, err := json.Marshal(state)
+		require.Nil(t, err)
+		var parsed BreakerState
+		require.Nil(t, json.Unmarshal(b, &parsed))
+		assert.Equal(t, state, parsed)
+	}
+	b, err := json.Marshal(BreakerHalfOpen)
+	require.Nil(t, err)
+	assert.Equal(t, `"half-open"`, string(b))
+
+	var state BreakerState
+	assert.Error(t, json.Unmarshal([]byte(`"broken"`), &state))
+}
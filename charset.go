@@ -0,0 +1,75 @@
+package sytralrt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// charsets are the encodings the files can be decoded from, by lower case name
+var charsets = map[string]encoding.Encoding{
+	"utf-8":        unicode.UTF8,
+	"utf8":         unicode.UTF8,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"latin1":       charmap.ISO8859_1,
+	"iso-8859-15":  charmap.ISO8859_15,
+	"latin9":       charmap.ISO8859_15,
+	"windows-1252": charmap.Windows1252,
+	"cp1252":       charmap.Windows1252,
+	// big endian unless the file starts with a byte order mark, as RFC 2781 says
+	"utf-16":   unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	"utf-16le": unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be": unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+}
+
+// LookupCharset returns the encoding named charset, like ISO-8859-1, Windows-1252 or UTF-16
+func LookupCharset(charset string) (encoding.Encoding, error) {
+	if e, ok := charsets[strings.ToLower(strings.TrimSpace(charset))]; ok {
+		return e, nil
+	}
+	names := make([]string, 0, len(charsets))
+	for name := range charsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown charset %s, expected one of %s", charset, strings.Join(names, ", "))
+}
+
+// getCharsetReader decodes the xml files whose declaration has another encoding than UTF-8
+func getCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	e, err := LookupCharset(charset)
+	if err != nil {
+		return nil, err
+	}
+	return e.NewDecoder().Reader(input), nil
+}
+
+// newDecodingReader decodes file to UTF-8 from charset, or from the UTF-8 or UTF-16 byte order mark it starts with.
+// The bytes are left as they are if charset is nil and there is no byte order mark.
+func newDecodingReader(file io.Reader, charset encoding.Encoding) io.Reader {
+	fallback := transform.Transformer(transform.Nop)
+	if charset != nil {
+		fallback = charset.NewDecoder()
+	}
+	return transform.NewReader(file, unicode.BOMOverride(fallback))
+}
+
+// skipBOM decodes file to UTF-8 if it starts with a byte order mark, bom is then true
+func skipBOM(file io.Reader) (reader io.Reader, bom bool) {
+	buffered := bufio.NewReader(file)
+	head, _ := buffered.Peek(3)
+	for _, mark := range [][]byte{{0xef, 0xbb, 0xbf}, {0xfe, 0xff}, {0xff, 0xfe}} {
+		if bytes.HasPrefix(head, mark) {
+			return newDecodingReader(buffered, nil), true
+		}
+	}
+	return buffered, false
+}
@@ -0,0 +1,104 @@
+package sytralrt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const decinesDeparture = "1;87A;Décines Centre;11 min;E;2018-09-17 20:28:00;35998;87A-022AM:5:2:12\r\n"
+
+func encode(t *testing.T, e encoding.Encoding, s string) string {
+	encoded, err := e.NewEncoder().String(s)
+	require.Nil(t, err)
+	return encoded
+}
+
+func TestLookupCharset(t *testing.T) {
+	for name, expected := range map[string]encoding.Encoding{
+		"ISO-8859-1":   charmap.ISO8859_1,
+		"latin9":       charmap.ISO8859_15,
+		"Windows-1252": charmap.Windows1252,
+		" cp1252 ":     charmap.Windows1252,
+		"utf-8":        unicode.UTF8,
+	} {
+		e, err := LookupCharset(name)
+		require.Nil(t, err, name)
+		assert.Equal(t, expected, e, name)
+	}
+	_, err := LookupCharset("ebcdic")
+	assert.Error(t, err)
+}
+
+func TestLoadDeparturesCharset(t *testing.T) {
+	for _, name := range []string{"ISO-8859-1", "ISO-8859-15", "Windows-1252", "UTF-16LE", "UTF-16"} {
+		charset, err := LookupCharset(name)
+		require.Nil(t, err)
+		content := encode(t, charset, decinesDeparture)
+		departures, err := loadDepartures(strings.NewReader(content), FetchOptions{Charset: charset}, nil)
+		require.Nil(t, err, name)
+		require.Len(t, departures["1"], 1, name)
+		assert.Equal(t, "Décines Centre", departures["1"][0].DirectionName, name)
+	}
+
+	// without a charset the bytes are kept as they are
+	latin1 := encode(t, charmap.ISO8859_1, decinesDeparture)
+	departures, err := loadDepartures(strings.NewReader(latin1), FetchOptions{}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, "D\xe9cines Centre", departures["1"][0].DirectionName)
+}
+
+func TestLoadDeparturesBOM(t *testing.T) {
+	for name, content := range map[string]string{
+		"utf-8":    "\xef\xbb\xbf" + decinesDeparture,
+		"utf-16le": encode(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), decinesDeparture),
+		"utf-16be": encode(t, unicode.UTF16(unicode.BigEndian, unicode.UseBOM), decinesDeparture),
+	} {
+		// the byte order mark prevails over the configured charset
+		departures, err := loadDepartures(strings.NewReader(content), FetchOptions{Charset: charmap.Windows1252}, nil)
+		require.Nil(t, err, name)
+		require.Contains(t, departures, "1", name)
+		assert.Equal(t, "Décines Centre", departures["1"][0].DirectionName, name)
+	}
+}
+
+func TestLoadParkingsBOM(t *testing.T) {
+	fixture := string(readFixture(t, "parkings.txt"))
+	// the header is only found if the byte order mark isn't kept in its first column
+	parkings, err := loadParkings(strings.NewReader("\xef\xbb\xbf"+fixture), FetchOptions{}, nil)
+	require.Nil(t, err)
+	require.Contains(t, parkings, "DECC")
+	assert.Equal(t, "Décines Centre", parkings["DECC"].Label)
+
+	latin1 := encode(t, charmap.ISO8859_1, fixture)
+	parkings, err = loadParkings(strings.NewReader(latin1), FetchOptions{Charset: charmap.ISO8859_1}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, "Décines Centre", parkings["DECC"].Label)
+}
+
+func TestLoadEquipmentsCharset(t *testing.T) {
+	fixture, err := charmap.ISO8859_1.NewDecoder().String(string(readFixture(t, "NET_ACCESS.XML")))
+	require.Nil(t, err)
+
+	for _, name := range []string{"ISO-8859-15", "Windows-1252", "UTF-16"} {
+		content := strings.Replace(fixture, `encoding="ISO-8859-1"`, `encoding="`+name+`"`, 1)
+		charset, err := LookupCharset(name)
+		require.Nil(t, err)
+		equipments, err := loadEquipments(strings.NewReader(encode(t, charset, content)), FetchOptions{}, nil)
+		require.Nil(t, err, name)
+		require.Len(t, equipments, 3, name)
+		labels := make([]string, 0, len(equipments))
+		for _, e := range equipments {
+			labels = append(labels, e.CurrentAvailability.Cause.Label)
+		}
+		assert.Contains(t, labels, "Problème technique", name)
+	}
+
+	_, err = loadEquipments(strings.NewReader(strings.Replace(fixture, "ISO-8859-1", "KOI8-R", 1)), FetchOptions{}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,230 @@
+package sytralrt
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column declares where a field of the records of a csv feed is read
+type Column struct {
+	// Name is the header of the column, it is looked up in the header row of the files having one
+	Name string
+	// Index is the position of the column from 0, used if Name is empty or the file has no header.
+	// It is -1 if the column can only be found by its name.
+	Index int
+	// Optional fields are left empty when their column is missing
+	Optional bool
+	// Layout parses the date fields, as time.Parse does
+	Layout string
+}
+
+// ColumnMapping maps the fields of a record to their column
+type ColumnMapping map[string]Column
+
+// DepartureColumns are the default columns of the departures files, which have no header
+var DepartureColumns = ColumnMapping{
+	"stop":            {Index: 0},
+	"line":            {Index: 1},
+	"direction_name":  {Index: 2},
+	"type":            {Index: 4},
+	"datetime":        {Index: 5, Layout: "2006-01-02 15:04:05"},
+	"direction":       {Index: 6},
+	"vehicle_journey": {Index: 7, Optional: true},
+	"route":           {Index: 8, Optional: true},
+	"direction_type":  {Index: 9, Optional: true},
+}
+
+// ParkingColumns are the default columns of the parkings files, looked up in their header
+var ParkingColumns = ColumnMapping{
+	"id":                          {Name: "COD_PAR_REL", Index: 0},
+	"label":                       {Name: "LIB_PAR_REL", Index: 1},
+	"updated_time":                {Name: "DATEHEURE_COMPTAGE", Index: 2, Layout: "2006-01-02 15:04:05"},
+	"available_standard_spaces":   {Name: "NB_TOT_PLACE_DISPO", Index: 4},
+	"total_standard_spaces":       {Name: "CAP_VEH_NOR", Index: 5},
+	"available_accessible_spaces": {Name: "NB_TOT_PLACE_PMR_DISPO", Index: 6},
+	"total_accessible_spaces":     {Name: "CAP_VEH_PMR", Index: 7},
+}
+
+// ParseColumnMapping parses field=column entries, the column being a header name or an index.
+// It may be followed by ? if the field is optional and by @layout for the date fields,
+// like datetime=5@2006-01-02T15:04:05 or direction_type=DIR?
+func ParseColumnMapping(entries []string) (ColumnMapping, error) {
+	mapping := make(ColumnMapping)
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid column %q, expected field=column", entry)
+		}
+		var column Column
+		spec := parts[1]
+		if i := strings.Index(spec, "@"); i >= 0 {
+			spec, column.Layout = spec[:i], spec[i+1:]
+		}
+		if strings.HasSuffix(spec, "?") {
+			spec, column.Optional = strings.TrimSuffix(spec, "?"), true
+		}
+		if index, err := strconv.Atoi(spec); err == nil && index >= 0 {
+			column.Index = index
+		} else {
+			column.Name, column.Index = spec, -1
+		}
+		mapping[strings.TrimSpace(parts[0])] = column
+	}
+	return mapping, nil
+}
+
+// withOverrides returns the mapping with the columns of some fields replaced, the date layouts are kept if not given
+func (m ColumnMapping) withOverrides(overrides ColumnMapping) (ColumnMapping, error) {
+	merged := make(ColumnMapping, len(m))
+	for field, column := range m {
+		merged[field] = column
+	}
+	for field, column := range overrides {
+		previous, ok := m[field]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %s, expected one of %s", field, strings.Join(m.fields(), ", "))
+		}
+		if column.Layout == "" {
+			column.Layout = previous.Layout
+		}
+		merged[field] = column
+	}
+	return merged, nil
+}
+
+func (m ColumnMapping) fields() []string {
+	fields := make([]string, 0, len(m))
+	for field := range m {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// columns are the columns of a mapping resolved for a file, -1 for the optional fields it doesn't have
+type columns struct {
+	record   string // what a record is, for the errors
+	indexes  map[string]int
+	layouts  map[string]string
+	optional map[string]bool
+}
+
+// resolve finds the columns of the fields in the header of a file, or uses their index if it has none
+func (m ColumnMapping) resolve(record string, header []string) (columns, error) {
+	resolved := columns{
+		record:   record,
+		indexes:  make(map[string]int, len(m)),
+		layouts:  make(map[string]string),
+		optional: make(map[string]bool),
+	}
+	for field, column := range m {
+		index := column.Index
+		if header == nil && index < 0 {
+			return columns{}, fmt.Errorf("the column %s of %s can't be found, the file has no header", column.Name, field)
+		} else if header != nil && column.Name != "" {
+			index = -1
+			for i, name := range header {
+				if strings.TrimSpace(name) == column.Name {
+					index = i
+					break
+				}
+			}
+		}
+		if header != nil && (index < 0 || index >= len(header)) {
+			if !column.Optional {
+				return columns{}, fmt.Errorf("the header has no column %s for %s", describeColumn(column), field)
+			}
+			index = -1
+		}
+		resolved.indexes[field] = index
+		resolved.layouts[field] = column.Layout
+		resolved.optional[field] = column.Optional
+	}
+	return resolved, nil
+}
+
+func describeColumn(column Column) string {
+	if column.Name != "" {
+		return column.Name
+	}
+	return fmt.Sprintf("#%d", column.Index)
+}
+
+// mustResolve resolves a mapping by index, it panics if it is invalid
+func mustResolve(mapping ColumnMapping, record string) columns {
+	resolved, err := mapping.resolve(record, nil)
+	if err != nil {
+		panic(err)
+	}
+	return resolved
+}
+
+// resolveOverrides resolves the default mapping with the columns of some fields replaced
+func resolveOverrides(defaults, overrides ColumnMapping, record string, header []string) (columns, error) {
+	mapping, err := defaults.withOverrides(overrides)
+	if err != nil {
+		return columns{}, err
+	}
+	return mapping.resolve(record, header)
+}
+
+// ValidateDepartureColumns checks the columns overridden for the departures files, which have no header:
+// their fields must be known and their columns given by index
+func ValidateDepartureColumns(overrides ColumnMapping) error {
+	_, err := newDepartureLineConsumer(overrides)
+	return err
+}
+
+// ValidateParkingColumns checks the columns overridden for the parkings files, their fields must be known
+func ValidateParkingColumns(overrides ColumnMapping) error {
+	_, err := newParkingLineConsumer(overrides)
+	return err
+}
+
+// field returns the value of a field of record, it is empty if the field is optional and missing
+func (c columns) field(record []string, field string) (string, error) {
+	index, ok := c.indexes[field]
+	if !ok {
+		return "", fmt.Errorf("unknown field %s", field)
+	}
+	if index < 0 || index >= len(record) {
+		if c.optional[field] {
+			return "", nil
+		}
+		return "", &missingFieldError{c.record}
+	}
+	return record[index], nil
+}
+
+// values returns the values of some fields of record
+func (c columns) values(record []string, fields ...string) ([]string, error) {
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		var err error
+		if values[i], err = c.field(record, field); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// date parses a date field with its layout
+func (c columns) date(record []string, field string, location *time.Location) (time.Time, error) {
+	value, err := c.field(record, field)
+	if err != nil || (value == "" && c.optional[field]) {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation(c.layouts[field], value, location)
+}
+
+// int parses an integer field
+func (c columns) int(record []string, field string) (int, error) {
+	value, err := c.field(record, field)
+	if err != nil || (value == "" && c.optional[field]) {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,116 @@
+package sytralrt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseColumnMapping(t *testing.T) {
+	mapping, err := ParseColumnMapping([]string{
+		"datetime=7@2006-01-02T15:04:05",
+		"direction_type=SENS?",
+		"label=NOM_PARC",
+	})
+	require.Nil(t, err)
+	assert.Equal(t, ColumnMapping{
+		"datetime":       {Index: 7, Layout: "2006-01-02T15:04:05"},
+		"direction_type": {Name: "SENS", Index: -1, Optional: true},
+		"label":          {Name: "NOM_PARC", Index: -1},
+	}, mapping)
+
+	for _, invalid := range []string{"datetime", "=5", "datetime="} {
+		_, err := ParseColumnMapping([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestValidateColumns(t *testing.T) {
+	assert.Nil(t, ValidateDepartureColumns(nil))
+	assert.Nil(t, ValidateDepartureColumns(ColumnMapping{"datetime": {Index: 7}}))
+	assert.Error(t, ValidateDepartureColumns(ColumnMapping{"vehicle": {Index: 8}}))
+	// the departures files have no header
+	assert.Error(t, ValidateDepartureColumns(ColumnMapping{"stop": {Name: "ARRET", Index: -1}}))
+
+	assert.Nil(t, ValidateParkingColumns(ColumnMapping{"label": {Name: "NOM_PARC", Index: -1}}))
+	assert.Error(t, ValidateParkingColumns(ColumnMapping{"name": {Name: "NOM_PARC", Index: -1}}))
+}
+
+func TestDeparturesColumns(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// the stop and the datetime are swapped, the datetime has another layout
+	content := "2018-09-17T20:38:37;C20A;Fort du Bruissin;21 min;T;3;47029;C20A-062BT:7:1:28\n"
+	columns, err := ParseColumnMapping([]string{"stop=5", "datetime=0@2006-01-02T15:04:05"})
+	require.Nil(err)
+	departures, err := loadDepartures(strings.NewReader(content), FetchOptions{Columns: columns}, nil)
+	require.Nil(err)
+	require.Len(departures["3"], 1)
+	location, err := time.LoadLocation("Europe/Paris")
+	require.Nil(err)
+	assert.Equal(time.Date(2018, 9, 17, 20, 38, 37, 0, location), departures["3"][0].Datetime)
+	assert.Equal("C20A", departures["3"][0].Line)
+
+	// the departures files have no header
+	columns, err = ParseColumnMapping([]string{"stop=STOP"})
+	require.Nil(err)
+	_, err = loadDepartures(strings.NewReader(content), FetchOptions{Columns: columns}, nil)
+	assert.Error(err)
+
+	_, err = loadDepartures(strings.NewReader(content), FetchOptions{Columns: ColumnMapping{"vehicle": {Index: 8}}}, nil)
+	assert.Error(err)
+
+	// a missing optional field is left empty, a missing required one is an error
+	columns, err = ParseColumnMapping([]string{"type=12?"})
+	require.Nil(err)
+	departures, err = loadDepartures(strings.NewReader(string(readFixture(t, "first.txt"))),
+		FetchOptions{Columns: columns}, nil)
+	require.Nil(err)
+	assert.Equal("", departures["3"][0].Type)
+	columns, err = ParseColumnMapping([]string{"type=12"})
+	require.Nil(err)
+	_, err = loadDepartures(strings.NewReader(string(readFixture(t, "first.txt"))),
+		FetchOptions{Columns: columns}, nil)
+	require.IsType(&LineError{}, err)
+	assert.IsType(&missingFieldError{}, err.(*LineError).Err)
+}
+
+func TestParkingsHeader(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lines := strings.Split(string(readFixture(t, "parkings.txt")), "\r\n")
+	// the columns are looked up in the header, whatever their order
+	swap := func(line string) string {
+		fields := strings.Split(line, ";")
+		fields[0], fields[1] = fields[1], fields[0]
+		return strings.Join(fields, ";")
+	}
+	swapped := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line != "" {
+			swapped = append(swapped, swap(line))
+		}
+	}
+	parkings, err := loadParkings(strings.NewReader(strings.Join(swapped, "\n")), FetchOptions{}, nil)
+	require.Nil(err)
+	require.Len(parkings, 19)
+	assert.Equal("Décines Centre", parkings["DECC"].Label)
+
+	// a required column missing from the header fails the whole load
+	renamed := strings.Replace(strings.Join(lines, "\n"), "CAP_VEH_PMR;", "CAPACITE_PMR;", 1)
+	_, err = loadParkings(strings.NewReader(renamed), FetchOptions{}, nil)
+	require.IsType(&LineError{}, err)
+	assert.Equal(1, err.(*LineError).Line)
+	assert.Contains(err.Error(), "CAP_VEH_PMR")
+	// unless it is declared
+	columns, err := ParseColumnMapping([]string{"total_accessible_spaces=CAPACITE_PMR"})
+	require.Nil(err)
+	parkings, err = loadParkings(strings.NewReader(renamed), FetchOptions{Columns: columns}, nil)
+	require.Nil(err)
+	assert.Len(parkings, 19)
+}
@@ -0,0 +1,180 @@
+package sytralrt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var deferredLoads = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sytralrt",
+	Name:      "deferred_loads",
+	Help:      "number of loads deferred because the file wasn't complete yet",
+}, []string{"feed"})
+
+func init() {
+	prometheus.MustRegister(deferredLoads)
+}
+
+// CompletenessOptions defines how a file still being uploaded is detected, the load is then deferred.
+// Every strategy set must be satisfied.
+type CompletenessOptions struct {
+	// StableDelay is the time between two stats of the file, its size and modification time mustn't change.
+	// Only file and sftp sources can be checked this way.
+	StableDelay time.Duration
+	// MarkerSuffix is the suffix of a file that must exist next to the file, like ".done" for extract_edylic.txt.done,
+	// and mustn't be older than it. Only file and sftp sources can be checked this way.
+	MarkerSuffix string
+	// Trailer is a pattern that the last line of the file must match, this line isn't loaded.
+	// If the pattern has a group, it must capture the number of lines preceding the trailer.
+	Trailer string
+}
+
+// incompleteFileError is returned when a file isn't complete yet
+type incompleteFileError struct {
+	reason string
+}
+
+func (e *incompleteFileError) Error() string {
+	return "incomplete file: " + e.reason
+}
+
+// deferIfIncomplete reports a load deferred because its file wasn't complete, it returns false for the other errors
+func deferIfIncomplete(feed string, err error) bool {
+	if _, ok := err.(*incompleteFileError); !ok {
+		return false
+	}
+	logrus.Infof("%s load deferred: %s", feed, err)
+	deferredLoads.WithLabelValues(feed).Inc()
+	return true
+}
+
+// withStat calls f with the stat function of the filesystem of uri, only file and sftp sources have one
+func withStat(uri url.URL, options FetchOptions, f func(stat func(string) (os.FileInfo, error)) error) error {
+	switch uri.Scheme {
+	case "sftp":
+		return withSftpClient(uri, options, func(client *sftp.Client) error {
+			return f(client.Stat)
+		})
+	case "file":
+		return f(os.Stat)
+	default:
+		return fmt.Errorf("the completeness of %s files can't be checked by stat", uri.Scheme)
+	}
+}
+
+// checkCompleteness applies the stat based strategies of options.Completeness to the file of uri,
+// nothing is checked if the file is still the one described by previous
+func checkCompleteness(uri url.URL, options FetchOptions, previous fileMetadata) error {
+	completeness := options.Completeness
+	if completeness.StableDelay <= 0 && completeness.MarkerSuffix == "" {
+		return nil
+	}
+	return withStat(uri, options, func(stat func(string) (os.FileInfo, error)) error {
+		info, err := stat(uri.Path)
+		if err != nil {
+			return err
+		}
+		metadata := fileMetadata{uri: uri.String(), Metadata: Metadata{Size: info.Size(), ModTime: info.ModTime()}}
+		if metadata.sameAs(previous) {
+			return nil
+		}
+
+		if completeness.MarkerSuffix != "" {
+			markerPath := uri.Path + completeness.MarkerSuffix
+			marker, err := stat(markerPath)
+			if os.IsNotExist(err) {
+				return &incompleteFileError{fmt.Sprintf("marker %s not found", markerPath)}
+			} else if err != nil {
+				return err
+			}
+			if marker.ModTime().Before(info.ModTime()) {
+				return &incompleteFileError{fmt.Sprintf("marker %s is older than %s", markerPath, uri.Path)}
+			}
+		}
+
+		if completeness.StableDelay > 0 {
+			time.Sleep(completeness.StableDelay)
+			again, err := stat(uri.Path)
+			if err != nil {
+				return err
+			}
+			if again.Size() != info.Size() || !again.ModTime().Equal(info.ModTime()) {
+				return &incompleteFileError{fmt.Sprintf("%s is still being written", uri.Path)}
+			}
+		}
+		return nil
+	})
+}
+
+// trailerReader withholds the last line of a file and checks it against a pattern once the end of the file is reached
+type trailerReader struct {
+	reader  *bufio.Reader
+	name    string
+	trailer *regexp.Regexp
+
+	pending []byte // the last line read, only returned once another line follows
+	buffer  []byte // what is left to return of the previous line
+	lines   int
+	err     error
+}
+
+func newTrailerReader(name string, reader io.Reader, trailer string) (*trailerReader, error) {
+	pattern, err := regexp.Compile(trailer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trailer pattern %q: %s", trailer, err)
+	}
+	return &trailerReader{reader: bufio.NewReader(reader), name: name, trailer: pattern}, nil
+}
+
+func (r *trailerReader) Read(p []byte) (int, error) {
+	for len(r.buffer) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		line, err := r.reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if r.pending != nil {
+				r.buffer = r.pending
+				r.lines++
+			}
+			r.pending = line
+		}
+		if err == io.EOF {
+			r.err = r.checkTrailer()
+		} else if err != nil {
+			r.err = err
+		}
+	}
+	n := copy(p, r.buffer)
+	r.buffer = r.buffer[n:]
+	return n, nil
+}
+
+func (r *trailerReader) checkTrailer() error {
+	trailer := strings.TrimRight(string(r.pending), "\r\n")
+	match := r.trailer.FindStringSubmatch(trailer)
+	if match == nil {
+		return &incompleteFileError{fmt.Sprintf("the last line of %s doesn't match %s", r.name, r.trailer)}
+	}
+	if len(match) > 1 {
+		count, err := strconv.Atoi(match[1])
+		if err != nil {
+			return fmt.Errorf("invalid line count %q in the trailer of %s", match[1], r.name)
+		}
+		if count != r.lines {
+			return &incompleteFileError{fmt.Sprintf("%s has %d lines, its trailer announces %d", r.name, r.lines, count)}
+		}
+	}
+	return io.EOF
+}
@@ -0,0 +1,198 @@
+package sytralrt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletenessMarker(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "sytralrt-complete")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "extract_edylic.txt")
+	uri, err := url.Parse(fmt.Sprintf("file://%s", path))
+	require.Nil(err)
+	options := defaultOptions
+	options.Completeness.MarkerSuffix = ".done"
+	deferred := counterValue(t, deferredLoads.WithLabelValues("departures"))
+
+	var manager DataManager
+	now := time.Now()
+	copyFixture(t, "first.txt", path, now)
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+	_, err = manager.GetDeparturesByStops([]string{"3"})
+	assert.Error(err)
+	assert.Equal(deferred+1, counterValue(t, deferredLoads.WithLabelValues("departures")))
+
+	// the marker of the previous upload
+	copyFixture(t, "oneline.txt", path+".done", now.Add(-time.Minute))
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+	_, err = manager.GetDeparturesByStops([]string{"3"})
+	assert.Error(err)
+	assert.Equal(deferred+2, counterValue(t, deferredLoads.WithLabelValues("departures")))
+
+	require.Nil(os.Chtimes(path+".done", now, now))
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+	departures, err := manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 4)
+}
+
+func TestCompletenessStableDelay(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "sytralrt-complete")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "extract_edylic.txt")
+	uri, err := url.Parse(fmt.Sprintf("file://%s", path))
+	require.Nil(err)
+	options := defaultOptions
+	options.Completeness.StableDelay = 200 * time.Millisecond
+
+	var manager DataManager
+	copyFixture(t, "oneline.txt", path, time.Now().Add(-time.Hour))
+	// the upload goes on while the file is checked
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		time.Sleep(50 * time.Millisecond)
+		copyFixture(t, "first.txt", path, time.Now())
+	}()
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+	<-written
+	_, err = manager.GetDeparturesByStops([]string{"3"})
+	assert.Error(err)
+
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+	departures, err := manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 4)
+}
+
+func TestCompletenessTrailer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "sytralrt-complete")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "extract_edylic.txt")
+	uri, err := url.Parse(fmt.Sprintf("file://%s", path))
+	require.Nil(err)
+	options := defaultOptions
+	options.Completeness.Trailer = `^#EOF;(\d+)$`
+	content := string(readFixture(t, "first.txt"))
+
+	var manager DataManager
+	tests := []struct {
+		name    string
+		content string
+		loaded  bool
+	}{
+		{"truncated", content[:len(content)-20], false},
+		{"without trailer", content, false},
+		{"wrong count", content + "#EOF;3\n", false},
+		{"complete", content + "#EOF;4\n", true},
+	}
+	for i, test := range tests {
+		require.Nil(ioutil.WriteFile(path, []byte(test.content), 0600))
+		modTime := time.Now().Add(time.Duration(i) * time.Minute)
+		require.Nil(os.Chtimes(path, modTime, modTime))
+		require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options), test.name)
+		_, err = manager.GetDeparturesByStops([]string{"3"})
+		assert.Equal(test.loaded, err == nil, test.name)
+	}
+	departures, err := manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 4)
+}
+
+func TestCompletenessTrailerOfEquipments(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "sytralrt-complete")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "NET_ACCESS.XML")
+	uri, err := url.Parse(fmt.Sprintf("file://%s", path))
+	require.Nil(err)
+	options := defaultOptions
+	options.Completeness.Trailer = `^#EOF$`
+	// the comment following the document is bigger than what the decoder buffers
+	content := strings.TrimRight(string(readFixture(t, "NET_ACCESS.XML")), "\r\n") + "\n<!--" +
+		strings.Repeat(" ", 16<<10) + "-->\n"
+
+	// the document is well-formed, but the end of the file is missing
+	var manager DataManager
+	require.Nil(ioutil.WriteFile(path, []byte(content), 0600))
+	require.Nil(RefreshEquipmentsWithOptions(&manager, *uri, options))
+	_, err = manager.GetEquipments()
+	require.Error(err)
+
+	require.Nil(ioutil.WriteFile(path, []byte(content+"#EOF\n"), 0600))
+	modTime := time.Now().Add(time.Minute)
+	require.Nil(os.Chtimes(path, modTime, modTime))
+	require.Nil(RefreshEquipmentsWithOptions(&manager, *uri, options))
+	equipments, err := manager.GetEquipments()
+	require.Nil(err)
+	assert.Len(t, equipments, 3)
+}
+
+func TestTrailerReader(t *testing.T) {
+	read := func(content, trailer string) (string, error) {
+		reader, err := newTrailerReader("test.txt", strings.NewReader(content), trailer)
+		require.Nil(t, err)
+		b, err := ioutil.ReadAll(reader)
+		return string(b), err
+	}
+
+	content, err := read("a\nb\r\nEND\r\n", "^END$")
+	assert.Nil(t, err)
+	assert.Equal(t, "a\nb\r\n", content)
+
+	content, err = read("a\nb\nEND 2", `^END (\d+)$`)
+	assert.Nil(t, err)
+	assert.Equal(t, "a\nb\n", content)
+
+	_, err = read("", "^END$")
+	assert.IsType(t, &incompleteFileError{}, err)
+	_, err = read("a\nb\nEND 3", `^END (\d+)$`)
+	assert.IsType(t, &incompleteFileError{}, err)
+
+	_, err = newTrailerReader("test.txt", strings.NewReader(""), "(")
+	assert.Error(t, err)
+}
+
+func TestSFTPCompletenessMarker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sytralrt-complete")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	server := newFakeSftpServer(t, nil)
+	defer server.Close()
+	path := filepath.Join(dir, "extract_edylic.txt")
+	copyFixture(t, "first.txt", path, time.Now().Add(-time.Minute))
+	uri, err := url.Parse(fmt.Sprintf("sftp://sytral:pass@%s%s", server.Addr(), path))
+	require.Nil(t, err)
+	options := defaultOptions
+	options.Completeness.MarkerSuffix = ".ok"
+
+	_, err = getFile(*uri, options)
+	assert.IsType(t, &incompleteFileError{}, err)
+
+	copyFixture(t, "oneline.txt", path+".ok", time.Now())
+	assert.Equal(t, string(readFixture(t, "first.txt")), readFetchedFile(t, *uri, options))
+}
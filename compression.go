@@ -0,0 +1,116 @@
+package sytralrt
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// DefaultMaxDecompressedSize is the decompressed size cap used if FetchOptions.MaxDecompressedSize isn't set
+const DefaultMaxDecompressedSize = 256 << 20
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zipMagic   = []byte("PK\x03\x04")
+)
+
+// compressionOf detects the compression of a file by its magic bytes, or by its extension if they are unknown
+func compressionOf(name string, header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(header, bzip2Magic):
+		return "bzip2"
+	case bytes.HasPrefix(header, zipMagic):
+		return "zip"
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".gz", ".gzip":
+		return "gzip"
+	case ".bz2", ".bzip2":
+		return "bzip2"
+	case ".zip":
+		return "zip"
+	}
+	return ""
+}
+
+// decompress returns a reader decompressing file on the fly if it is a gzip, bzip2 or single entry zip archive,
+// it fails once more than maxSize bytes have been decompressed
+func decompress(name string, file io.Reader, maxSize int64) (io.Reader, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDecompressedSize
+	}
+	buffered := bufio.NewReader(file)
+	// a file shorter than the magic bytes isn't compressed
+	header, _ := buffered.Peek(len(zipMagic))
+
+	var reader io.Reader
+	switch compressionOf(name, header) {
+	case "gzip":
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip file %s: %s", name, err)
+		}
+		reader = gzipReader
+	case "bzip2":
+		reader = bzip2.NewReader(buffered)
+	case "zip":
+		entry, err := openSingleZipEntry(name, buffered, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		reader = entry
+	default:
+		return buffered, nil
+	}
+	return &cappedReader{reader: reader, what: "decompressed size of " + name, max: maxSize}, nil
+}
+
+// openSingleZipEntry opens the only file of a zip archive, the archive is read in memory
+// since its directory is at the end: it fails if it is bigger than maxSize
+func openSingleZipEntry(name string, file io.Reader, maxSize int64) (io.Reader, error) {
+	content, err := ioutil.ReadAll(&cappedReader{reader: file, what: "size of zip file " + name, max: maxSize})
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip file %s: %s", name, err)
+	}
+	var entries []*zip.File
+	for _, entry := range archive.File {
+		if !entry.FileInfo().IsDir() {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("zip file %s contains %d files, only one is expected", name, len(entries))
+	}
+	return entries[0].Open()
+}
+
+// cappedReader fails once more than max bytes have been read
+type cappedReader struct {
+	reader io.Reader
+	what   string // what is capped, for the error message
+	max    int64
+	read   int64
+}
+
+func (r *cappedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if r.read > r.max {
+		return 0, fmt.Errorf("%s exceeds %d bytes", r.what, r.max)
+	}
+	return n, err
+}
@@ -0,0 +1,128 @@
+package sytralrt
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCompressedFile(t *testing.T) {
+	expected, err := ioutil.ReadFile(fmt.Sprintf("%s/first.txt", fixtureDir))
+	require.Nil(t, err)
+
+	for _, fixture := range []string{"first.txt.gz", "first.txt.bz2", "first.txt.zip"} {
+		t.Run(fixture, func(t *testing.T) {
+			uri, err := url.Parse(fmt.Sprintf("file://%s/%s", fixtureDir, fixture))
+			require.Nil(t, err)
+			reader, err := getFile(*uri, defaultOptions)
+			require.Nil(t, err)
+			b, err := ioutil.ReadAll(reader)
+			require.Nil(t, err)
+			assert.Equal(t, string(expected), string(b))
+
+			var manager DataManager
+			require.Nil(t, RefreshDeparturesWithOptions(&manager, *uri, defaultOptions))
+			departures, err := manager.GetDeparturesByStops([]string{"3"})
+			require.Nil(t, err)
+			assert.Len(t, departures, 4)
+		})
+	}
+}
+
+func gzipped(t *testing.T, content []byte) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write(content)
+	require.Nil(t, err)
+	require.Nil(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func TestDecompressDetection(t *testing.T) {
+	assert := assert.New(t)
+
+	// the magic bytes win over the extension
+	reader, err := decompress("extract.txt", bytes.NewReader(gzipped(t, []byte(oneline))), 0)
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	assert.Equal(oneline, string(b))
+
+	reader, err = decompress("extract.txt", strings.NewReader(oneline), 0)
+	require.Nil(t, err)
+	b, err = ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	assert.Equal(oneline, string(b))
+
+	// files shorter than the magic bytes are read as is
+	reader, err = decompress("extract.txt", strings.NewReader("a"), 0)
+	require.Nil(t, err)
+	b, err = ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	assert.Equal("a", string(b))
+
+	// without magic bytes the extension is used
+	_, err = decompress("extract.txt.gz", strings.NewReader(oneline), 0)
+	assert.Error(err)
+}
+
+func TestDecompressedSizeIsCapped(t *testing.T) {
+	bomb := gzipped(t, bytes.Repeat([]byte{'0'}, 10<<20))
+	reader, err := decompress("extract.txt.gz", bytes.NewReader(bomb), 1<<20)
+	require.Nil(t, err)
+	_, err = ioutil.ReadAll(reader)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds")
+
+	reader, err = decompress("extract.txt.gz", bytes.NewReader(bomb), 20<<20)
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	assert.Len(t, b, 10<<20)
+}
+
+func TestDecompressZipWithSeveralFiles(t *testing.T) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for _, name := range []string{"first.txt", "second.txt"} {
+		writer, err := archive.Create(name)
+		require.Nil(t, err)
+		_, err = writer.Write([]byte(oneline))
+		require.Nil(t, err)
+	}
+	require.Nil(t, archive.Close())
+
+	_, err := decompress("extract.zip", &buffer, 0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "contains 2 files")
+}
+
+func TestZipArchiveSizeIsCapped(t *testing.T) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	// a stored entry isn't smaller once compressed
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: "extract.txt", Method: zip.Store})
+	require.Nil(t, err)
+	_, err = writer.Write(bytes.Repeat([]byte{'0'}, 2<<20))
+	require.Nil(t, err)
+	require.Nil(t, archive.Close())
+
+	// the archive is read in memory, it can't be bigger than the decompressed size cap
+	_, err = decompress("extract.zip", bytes.NewReader(buffer.Bytes()), 1<<20)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "size of zip file extract.zip exceeds")
+
+	reader, err := decompress("extract.zip", bytes.NewReader(buffer.Bytes()), 4<<20)
+	require.Nil(t, err)
+	b, err := ioutil.ReadAll(reader)
+	require.Nil(t, err)
+	assert.Len(t, b, 2<<20)
+}
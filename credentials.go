@@ -0,0 +1,86 @@
+package sytralrt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// CredentialsOptions defines where the credentials of a source are read when they aren't part of its uri.
+// The password is read again every time a connection is opened, so that it can be rotated without a restart.
+type CredentialsOptions struct {
+	// Username replaces the user of the uri, it is the access key for s3 sources
+	Username string
+	// PasswordFile is a file containing the password, like a Docker or Kubernetes secret.
+	// The surrounding whitespaces are ignored.
+	PasswordFile string
+	// PasswordEnv is the name of an environment variable containing the password, used if PasswordFile is empty
+	PasswordEnv string
+}
+
+// readPassword returns the password of options, ok is false if none is configured
+func readPassword(options CredentialsOptions) (password string, ok bool, err error) {
+	if options.PasswordFile != "" {
+		secret, err := ioutil.ReadFile(options.PasswordFile)
+		if err != nil {
+			return "", false, fmt.Errorf("unable to read the password file: %s", err)
+		}
+		return strings.TrimSpace(string(secret)), true, nil
+	}
+	if options.PasswordEnv != "" {
+		password, ok := os.LookupEnv(options.PasswordEnv)
+		if !ok {
+			return "", false, fmt.Errorf("the password environment variable %s isn't set", options.PasswordEnv)
+		}
+		return password, true, nil
+	}
+	return "", false, nil
+}
+
+// withCredentials returns uri with the credentials of options, the ones of the uri are kept if there are none
+func withCredentials(uri url.URL, options CredentialsOptions) (url.URL, error) {
+	password, ok, err := readPassword(options)
+	if err != nil {
+		return uri, err
+	}
+	if options.Username == "" && !ok {
+		return uri, nil
+	}
+	username := options.Username
+	if username == "" && uri.User != nil {
+		username = uri.User.Username()
+	}
+	if !ok && uri.User != nil {
+		password, ok = uri.User.Password()
+	}
+	if ok {
+		uri.User = url.UserPassword(username, password)
+	} else {
+		uri.User = url.User(username)
+	}
+	return uri, nil
+}
+
+// errInvalidURL replaces the errors of url.Parse, whose message contains the url and its password
+func errInvalidURL(what string) error {
+	return fmt.Errorf("invalid %s, it can't be parsed as an url", what)
+}
+
+// RedactURI hides the password of an uri so that it can be logged or exposed
+func RedactURI(uri url.URL) string {
+	if _, ok := uri.User.Password(); ok {
+		uri.User = url.UserPassword(uri.User.Username(), "xxxxx")
+	}
+	return uri.String()
+}
+
+// RedactURIs hides the passwords of a list of uris, joined by commas
+func RedactURIs(uris []url.URL) string {
+	redacted := make([]string, 0, len(uris))
+	for _, uri := range uris {
+		redacted = append(redacted, RedactURI(uri))
+	}
+	return strings.Join(redacted, ",")
+}
@@ -1,45 +1,177 @@
 package sytralrt
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Temporary structures used only to read FLUX xml for equipments:
 type Root struct {
-	XMLName xml.Name   `xml:"root"`
-	Info    Info       `xml:"infos_generales"`
-	Data    Equipments `xml:"donnees"`
+	XMLName xml.Name         `xml:"root"`
+	Info    Info             `xml:"infos_generales"`
+	Data    Equipments       `xml:"donnees"`
+	Unknown []unknownElement `xml:",any"`
 }
 
 type Info struct {
 	XMLName xml.Name `xml:"infos_generales"`
 	Date    string   `xml:"date,attr"`
 	Hour    string   `xml:"heure,attr"`
+	// Valid is the etat_valide attribute as written, a boolean like "true" or "false" ("1", "0" and the other
+	// forms of strconv.ParseBool too). The document is rejected unless it is true, or if it is missing.
+	Valid   string           `xml:"etat_valide,attr"`
+	Unknown []unknownElement `xml:",any"`
 }
 
 type Equipments struct {
-	XMLName xml.Name `xml:"donnees"`
-	Lines   []Line   `xml:"ligne"`
+	XMLName xml.Name         `xml:"donnees"`
+	Lines   []Line           `xml:"ligne"`
+	Unknown []unknownElement `xml:",any"`
 }
 
 type Line struct {
-	XMLName  xml.Name  `xml:"ligne"`
-	Code     string    `xml:"code,attr"`
-	Label    string    `xml:"libelle,attr"`
-	Stations []Station `xml:"station"`
+	XMLName  xml.Name         `xml:"ligne"`
+	Code     string           `xml:"code,attr"`
+	Label    string           `xml:"libelle,attr"`
+	Stations []Station        `xml:"station"`
+	Unknown  []unknownElement `xml:",any"`
 }
 
 type Station struct {
 	XMLName    xml.Name           `xml:"station"`
 	Equipments []EquipementSource `xml:"equipement"`
+	Unknown    []unknownElement   `xml:",any"`
 }
 
 type EquipementSource struct {
-	XMLName xml.Name `xml:"equipement"`
-	Type    string   `xml:"type,attr"`
-	ID      string   `xml:"code_client,attr"`
-	Name    string   `xml:"nom_client,attr"`
-	Cause   string   `xml:"cause,attr"`
-	Effect  string   `xml:"consequence,attr"`
-	Start   string   `xml:"date_debut_indisponibilite,attr"`
-	End     string   `xml:"date_remise_service,attr"`
-	Hour    string   `xml:"heure_remise_service,attr"`
+	XMLName xml.Name         `xml:"equipement"`
+	Type    string           `xml:"type,attr"`
+	ID      string           `xml:"code_client,attr"`
+	Name    string           `xml:"nom_client,attr"`
+	Cause   string           `xml:"cause,attr"`
+	Effect  string           `xml:"consequence,attr"`
+	Start   string           `xml:"date_debut_indisponibilite,attr"`
+	End     string           `xml:"date_remise_service,attr"`
+	Hour    string           `xml:"heure_remise_service,attr"`
+	Unknown []unknownElement `xml:",any"`
+}
+
+// unknownElement is an element the equipments documents aren't expected to have
+type unknownElement struct {
+	XMLName xml.Name
+}
+
+// ErrInvalidDocument is returned for the equipments documents flagged as invalid by their producer
+var ErrInvalidDocument = errors.New("the document is flagged as invalid")
+
+var (
+	errMissingElement   = errors.New("missing element")
+	errMissingAttribute = errors.New("missing required attribute")
+	errUnknownElement   = errors.New("unknown element")
+)
+
+// XMLPathError locates an error of an equipments document by the path of its element or attribute,
+// like /root/donnees/ligne[2]/station[1]/equipement[3]/@code_client
+type XMLPathError struct {
+	Path string
+	Err  error
+}
+
+func (e *XMLPathError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+// attribute is a required attribute of an element, its value is empty if it is missing
+type attribute struct {
+	name  string
+	value string
+}
+
+// checkElement checks that the element at path has no unknown child and has its required attributes
+func checkElement(path string, unknown []unknownElement, required ...attribute) error {
+	if len(unknown) > 0 {
+		return &XMLPathError{Path: path + "/" + unknown[0].XMLName.Local, Err: errUnknownElement}
+	}
+	for _, a := range required {
+		if strings.TrimSpace(a.value) == "" {
+			return &XMLPathError{Path: path + "/@" + a.name, Err: errMissingAttribute}
+		}
+	}
+	return nil
+}
+
+// validate checks the structure of the document and its validity flag,
+// the attributes of the equipments are checked when they are read by readEquipment
+func (r Root) validate() error {
+	if err := checkElement("/root", r.Unknown); err != nil {
+		return err
+	}
+	info := "/root/infos_generales"
+	if r.Info.XMLName.Local == "" {
+		return &XMLPathError{Path: info, Err: errMissingElement}
+	}
+	err := checkElement(info, r.Info.Unknown,
+		attribute{"date", r.Info.Date}, attribute{"heure", r.Info.Hour}, attribute{"etat_valide", r.Info.Valid})
+	if err != nil {
+		return err
+	}
+	valid, err := strconv.ParseBool(r.Info.Valid)
+	if err != nil {
+		return &XMLPathError{Path: info + "/@etat_valide", Err: fmt.Errorf("invalid boolean %q", r.Info.Valid)}
+	} else if !valid {
+		return &XMLPathError{Path: info + "/@etat_valide", Err: ErrInvalidDocument}
+	}
+
+	data := "/root/donnees"
+	if r.Data.XMLName.Local == "" {
+		return &XMLPathError{Path: data, Err: errMissingElement}
+	}
+	if err := checkElement(data, r.Data.Unknown); err != nil {
+		return err
+	}
+	for i, l := range r.Data.Lines {
+		line := fmt.Sprintf("%s/ligne[%d]", data, i+1)
+		if err := checkElement(line, l.Unknown, attribute{"code", l.Code}); err != nil {
+			return err
+		}
+		for j, s := range l.Stations {
+			station := fmt.Sprintf("%s/station[%d]", line, j+1)
+			if err := checkElement(station, s.Unknown); err != nil {
+				return err
+			}
+			for k, e := range s.Equipments {
+				if err := checkElement(equipmentPath(i, j, k), e.Unknown); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// equipmentPath is the path of an equipment from the index of its line, of its station and its own, from 0
+func equipmentPath(line, station, equipment int) string {
+	return fmt.Sprintf("/root/donnees/ligne[%d]/station[%d]/equipement[%d]", line+1, station+1, equipment+1)
+}
+
+// readEquipment checks the attributes required by the equipment at path and reads it, its errors are located
+func readEquipment(path string, es EquipementSource, updatedAt time.Time,
+	location *time.Location) (*EquipmentDetail, error) {
+	err := checkElement(path, nil, attribute{"type", es.Type}, attribute{"code_client", es.ID},
+		attribute{"date_debut_indisponibilite", es.Start}, attribute{"date_remise_service", es.End},
+		attribute{"heure_remise_service", es.Hour})
+	if err != nil {
+		return nil, err
+	}
+	ed, err := NewEquipmentDetail(es, updatedAt, location)
+	if pathErr, ok := err.(*XMLPathError); ok {
+		return nil, &XMLPathError{Path: path + "/" + pathErr.Path, Err: pathErr.Err}
+	} else if err != nil {
+		return nil, &XMLPathError{Path: path, Err: err}
+	}
+	return ed, nil
 }
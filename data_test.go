@@ -0,0 +1,83 @@
+package sytralrt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// equipmentsDocument returns NET_ACCESS.XML with old replaced by new
+func equipmentsDocument(t *testing.T, old, new string) string {
+	fixture, err := charmap.ISO8859_1.NewDecoder().String(string(readFixture(t, "NET_ACCESS.XML")))
+	require.Nil(t, err)
+	require.Contains(t, fixture, old)
+	return encode(t, charmap.ISO8859_1, strings.Replace(fixture, old, new, 1))
+}
+
+func TestValidateEquipments(t *testing.T) {
+	const equipment = "/root/donnees/ligne[1]/station[1]/equipement[1]"
+	tests := []struct {
+		name     string
+		old, new string
+		path     string
+		err      error
+	}{
+		{"flagged invalid", `etat_valide="true"`, `etat_valide="false"`,
+			"/root/infos_generales/@etat_valide", ErrInvalidDocument},
+		{"no validity flag", ` etat_valide="true"`, "", "/root/infos_generales/@etat_valide", errMissingAttribute},
+		{"missing element", `<infos_generales date="2018-09-15" heure="12:01:31" etat_valide="true"/>`, "",
+			"/root/infos_generales", errMissingElement},
+		{"unknown element", `<station libelle="Gorge de Loup">`, `<station libelle="Gorge de Loup"><ascenseur/>`,
+			"/root/donnees/ligne[1]/station[1]/ascenseur", errUnknownElement},
+		{"missing line code", `code="D"`, "", "/root/donnees/ligne[1]/@code", errMissingAttribute},
+		{"missing id", `code_client="821"`, "", equipment + "/@code_client", errMissingAttribute},
+		{"missing hour", `date_remise_service="2018-09-14" heure_remise_service="13:00:00"`,
+			`date_remise_service="2018-09-14"`, equipment + "/@heure_remise_service", errMissingAttribute},
+		{"unknown type", `type="ASCENSEUR" code_client="821"`, `type="TAPIS" code_client="821"`,
+			equipment + "/@type", nil},
+		{"start after end", `date_debut_indisponibilite="2018-09-14" date_remise_service="2018-09-14"`,
+			`date_debut_indisponibilite="2018-09-15" date_remise_service="2018-09-14"`,
+			equipment + "/@date_debut_indisponibilite", nil},
+	}
+	for _, test := range tests {
+		document := equipmentsDocument(t, test.old, test.new)
+		_, err := loadEquipments(strings.NewReader(document), FetchOptions{}, nil)
+		require.IsType(t, &XMLPathError{}, err, test.name)
+		assert.Equal(t, test.path, err.(*XMLPathError).Path, test.name)
+		if test.err != nil {
+			assert.Equal(t, test.err, err.(*XMLPathError).Err, test.name)
+		}
+	}
+
+	_, err := loadEquipments(strings.NewReader(equipmentsDocument(t, `etat_valide="true"`, `etat_valide="1"`)),
+		FetchOptions{}, nil)
+	assert.Nil(t, err)
+}
+
+func TestLenientEquipments(t *testing.T) {
+	document := equipmentsDocument(t, `code_client="821"`, "")
+	rejections := newRejectionReport(LenientOptions{Enabled: true})
+	equipments, err := loadEquipments(strings.NewReader(document), FetchOptions{}, rejections)
+	require.Nil(t, err)
+	assert.Len(t, equipments, 2)
+	require.Len(t, rejections.Rejected, 1)
+	assert.Equal(t, "missing_field", rejections.Rejected[0].Reason)
+	assert.Equal(t, "/root/donnees/ligne[1]/station[1]/equipement[1]/@code_client: missing required attribute",
+		rejections.Rejected[0].Message)
+
+	// the structure of the document can't be skipped
+	document = equipmentsDocument(t, `etat_valide="true"`, `etat_valide="false"`)
+	_, err = loadEquipments(strings.NewReader(document), FetchOptions{}, newRejectionReport(LenientOptions{Enabled: true}))
+	assert.Error(t, err)
+}
+
+func TestIngestErrorPath(t *testing.T) {
+	var manager DataManager
+	_, err := Ingest(&manager, "equipments", strings.NewReader(equipmentsDocument(t, `code="D"`, "")))
+	require.Error(t, err)
+	assert.Equal(t, IngestError{Path: "/root/donnees/ligne[1]/@code", Message: "missing required attribute"},
+		newIngestError(err))
+}
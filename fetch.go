@@ -0,0 +1,105 @@
+package sytralrt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrNotModified is returned by a Fetcher instead of a file that hasn't changed since it has been loaded
+var ErrNotModified = errors.New("file not modified")
+
+// Metadata identifies the version of a file on its source
+type Metadata struct {
+	Size    int64 // -1 if unknown
+	ModTime time.Time
+	// Version is an opaque identifier of the content of the file, like an ETag.
+	// If set, it is compared instead of the size and modification time.
+	Version string
+}
+
+// sameAs returns true if both metadata describe the same version of a file
+func (m Metadata) sameAs(other Metadata) bool {
+	if m.Version != "" || other.Version != "" {
+		return m.Version == other.Version
+	}
+	return !m.ModTime.IsZero() && m.ModTime.Equal(other.ModTime) && m.Size == other.Size
+}
+
+// Fetcher opens the files of the uris of a scheme, like a Source of data files
+type Fetcher interface {
+	// Fetch opens the file of uri, the reader is closed once the file has been loaded.
+	// previous describes the version of the file currently loaded, it is empty if there is none:
+	// ErrNotModified may be returned if the file is still this version.
+	// Otherwise the metadata of the file opened is compared with previous, the file isn't loaded if they are the same.
+	Fetch(uri url.URL, options FetchOptions, previous Metadata) (io.ReadCloser, Metadata, error)
+}
+
+// FetcherFunc adapts a function to the Fetcher interface
+type FetcherFunc func(uri url.URL, options FetchOptions, previous Metadata) (io.ReadCloser, Metadata, error)
+
+// Fetch calls f
+func (f FetcherFunc) Fetch(uri url.URL, options FetchOptions, previous Metadata) (io.ReadCloser, Metadata, error) {
+	return f(uri, options, previous)
+}
+
+type fetcherRegistry struct {
+	mutex    sync.RWMutex
+	fetchers map[string]Fetcher
+}
+
+var fetchers = &fetcherRegistry{fetchers: map[string]Fetcher{
+	"file": FetcherFunc(func(uri url.URL, _ FetchOptions, previous Metadata) (io.ReadCloser, Metadata, error) {
+		return getFileWithFS(uri, previous)
+	}),
+	"sftp":  FetcherFunc(getFileWithSftp),
+	"http":  FetcherFunc(getFileWithHTTP),
+	"https": FetcherFunc(getFileWithHTTP),
+	"s3":    FetcherFunc(getFileWithS3),
+	"ftp":   FetcherFunc(getFileWithFtp),
+	"ftps":  FetcherFunc(getFileWithFtp),
+}}
+
+// RegisterFetcher makes the uris of a scheme fetched by fetcher, the built-in fetcher of the scheme is replaced if any.
+// Every feed can then be refreshed from these uris.
+func RegisterFetcher(scheme string, fetcher Fetcher) {
+	fetchers.mutex.Lock()
+	defer fetchers.mutex.Unlock()
+	fetchers.fetchers[scheme] = fetcher
+}
+
+func (r *fetcherRegistry) get(scheme string) (Fetcher, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	fetcher, ok := r.fetchers[scheme]
+	return fetcher, ok
+}
+
+// getRawFileIfModified opens a file with the fetcher of its scheme, unless it is still the one described by previous
+func getRawFileIfModified(uri url.URL, options FetchOptions,
+	previous fileMetadata) (io.ReadCloser, fileMetadata, error) {
+	fetcher, ok := fetchers.get(uri.Scheme)
+	if !ok {
+		return nil, fileMetadata{}, fmt.Errorf("Unsupported protocols %s", uri.Scheme)
+	}
+	var current Metadata
+	if previous.uri == uri.String() {
+		current = previous.Metadata
+	}
+	file, metadata, err := fetcher.Fetch(uri, options, current)
+	if err == ErrNotModified {
+		return nil, previous, err
+	} else if err != nil {
+		return nil, fileMetadata{}, err
+	}
+	fetched := fileMetadata{uri: uri.String(), Metadata: metadata}
+	// some sources can't tell whether a file has changed before it is opened
+	if fetched.sameAs(previous) {
+		file.Close()
+		return nil, fetched, ErrNotModified
+	}
+	return file, fetched, nil
+}
@@ -0,0 +1,103 @@
+package sytralrt
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryFetcher serves files kept in memory, versioned by a counter
+type memoryFetcher struct {
+	mutex    sync.Mutex
+	files    map[string][]byte
+	versions map[string]int
+	previous []Metadata // the previous metadata received by each call
+}
+
+func (f *memoryFetcher) Put(path string, content []byte) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.files[path] = content
+	f.versions[path]++
+}
+
+func (f *memoryFetcher) Fetch(uri url.URL, _ FetchOptions, previous Metadata) (io.ReadCloser, Metadata, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.previous = append(f.previous, previous)
+	content, ok := f.files[uri.Path]
+	if !ok {
+		return nil, Metadata{}, ErrNotModified
+	}
+	metadata := Metadata{Size: int64(len(content)), Version: strconv.Itoa(f.versions[uri.Path])}
+	return ioutil.NopCloser(bytes.NewReader(content)), metadata, nil
+}
+
+func registerTestFetcher(t *testing.T, scheme string, fetcher Fetcher) {
+	RegisterFetcher(scheme, fetcher)
+	fetchers.mutex.Lock()
+	defer fetchers.mutex.Unlock()
+	_, ok := fetchers.fetchers[scheme]
+	require.True(t, ok)
+}
+
+func unregisterTestFetcher(scheme string) {
+	fetchers.mutex.Lock()
+	defer fetchers.mutex.Unlock()
+	delete(fetchers.fetchers, scheme)
+}
+
+func TestRegisteredFetcher(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fetcher := &memoryFetcher{files: make(map[string][]byte), versions: make(map[string]int)}
+	registerTestFetcher(t, "mem", fetcher)
+	defer unregisterTestFetcher("mem")
+	fetcher.Put("/departures.txt", readFixture(t, "first.txt"))
+	uri, err := url.Parse("mem:///departures.txt")
+	require.Nil(err)
+
+	var manager DataManager
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, defaultOptions))
+	departures, err := manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 4)
+
+	// the version is unchanged: the file is opened but not loaded
+	lastUpdate := manager.GetLastDepartureDataUpdate()
+	time.Sleep(time.Millisecond)
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, defaultOptions))
+	assert.Equal(lastUpdate, manager.GetLastDepartureDataUpdate())
+
+	fetcher.Put("/departures.txt", readFixture(t, "second.txt"))
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, defaultOptions))
+	departures, err = manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 3)
+
+	// previous is only given for the same uri
+	other, err := url.Parse("mem:///other.txt")
+	require.Nil(err)
+	require.Nil(RefreshDeparturesWithOptions(&manager, *other, defaultOptions))
+	require.Len(fetcher.previous, 4)
+	assert.Equal(Metadata{}, fetcher.previous[0])
+	assert.Equal("1", fetcher.previous[1].Version)
+	assert.Equal("1", fetcher.previous[2].Version)
+	assert.Equal(Metadata{}, fetcher.previous[3])
+}
+
+func TestUnsupportedScheme(t *testing.T) {
+	uri, err := url.Parse("gopher://localhost/departures.txt")
+	require.Nil(t, err)
+	_, err = getFile(*uri, defaultOptions)
+	assert.Error(t, err)
+}
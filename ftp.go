@@ -0,0 +1,73 @@
+package sytralrt
+
+import (
+	"io"
+	"net"
+	"net/url"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// FTPOptions defines how the connection to a ftp server is established
+type FTPOptions struct {
+	// ImplicitTLS makes ftps sources negotiate TLS as soon as the connection is opened (usually on port 990)
+	// instead of upgrading it with AUTH TLS
+	ImplicitTLS bool
+	// DisableEPSV forces the use of PASV to open the passive data connections
+	DisableEPSV bool
+}
+
+// getFileWithFtp always opens the file, ftp servers don't give the metadata of the file being downloaded
+func getFileWithFtp(uri url.URL, options FetchOptions, _ Metadata) (io.ReadCloser, Metadata, error) {
+	dialOptions := []ftp.DialOption{
+		ftp.DialWithTimeout(options.ConnectionTimeout),
+		ftp.DialWithDisabledEPSV(options.FTP.DisableEPSV),
+	}
+	port := "21"
+	if uri.Scheme == "ftps" {
+		tlsConfig, err := newTLSConfig(options.TLS)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		tlsConfig.ServerName = uri.Hostname()
+		if options.FTP.ImplicitTLS {
+			port = "990"
+			dialOptions = append(dialOptions, ftp.DialWithTLS(tlsConfig))
+		} else {
+			dialOptions = append(dialOptions, ftp.DialWithExplicitTLS(tlsConfig))
+		}
+	}
+	if uri.Port() != "" {
+		port = uri.Port()
+	}
+
+	uri, err := withCredentials(uri, options.Credentials)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	conn, err := ftp.Dial(net.JoinHostPort(uri.Hostname(), port), dialOptions...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	user, password := "anonymous", "anonymous"
+	if uri.User != nil {
+		user = uri.User.Username()
+		password, _ = uri.User.Password()
+	}
+	if err = conn.Login(user, password); err != nil {
+		conn.Quit() //nolint:errcheck
+		return nil, Metadata{}, err
+	}
+
+	response, err := conn.Retr(uri.Path)
+	if err != nil {
+		conn.Quit() //nolint:errcheck
+		return nil, Metadata{}, err
+	}
+	return readCloser{Reader: response, Closer: closerFunc(func() error {
+		err := response.Close()
+		conn.Quit() //nolint:errcheck
+		return err
+	})}, Metadata{Size: -1}, nil
+}
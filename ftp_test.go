@@ -0,0 +1,261 @@
+package sytralrt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCertificate creates a self signed certificate for 127.0.0.1 and writes it in a PEM file usable as CA
+func newTestCertificate(t *testing.T) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"sytralrt"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.Nil(t, err)
+
+	caFile, err := ioutil.TempFile("", "sytralrt-ca")
+	require.Nil(t, err)
+	require.Nil(t, pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	require.Nil(t, caFile.Close())
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile.Name()
+}
+
+// fakeFtpServer is a minimal read only ftp server serving the files of a directory
+type fakeFtpServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	root      string
+}
+
+func newFakeFtpServer(t *testing.T, tlsConfig *tls.Config, implicitTLS bool) *fakeFtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	if implicitTLS {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	server := &fakeFtpServer{listener: listener, tlsConfig: tlsConfig, root: fixtureDir}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, implicitTLS)
+		}
+	}()
+	return server
+}
+
+func (s *fakeFtpServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeFtpServer) Close() {
+	s.listener.Close()
+}
+
+func (s *fakeFtpServer) serve(conn net.Conn, protected bool) {
+	defer func() { conn.Close() }()
+	text := textproto.NewConn(conn)
+	reply := func(format string, args ...interface{}) {
+		text.PrintfLine(format, args...) //nolint:errcheck
+	}
+	var user string
+	var loggedIn bool
+	var data net.Listener
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+
+	reply("220 sytralrt test server")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument := line, ""
+		if i := strings.Index(line, " "); i >= 0 {
+			command, argument = line[:i], line[i+1:]
+		}
+		switch strings.ToUpper(command) {
+		case "AUTH":
+			reply("234 AUTH TLS successful")
+			conn = tls.Server(conn, s.tlsConfig)
+			text = textproto.NewConn(conn)
+		case "USER":
+			user = argument
+			reply("331 Password required")
+		case "PASS":
+			loggedIn = user == "sytral" && argument == "pass"
+			if !loggedIn {
+				reply("530 Login incorrect")
+				continue
+			}
+			reply("230 Logged in")
+		case "FEAT":
+			reply("211-Features:")
+			reply(" EPSV")
+			reply("211 End")
+		case "TYPE", "PBSZ":
+			reply("200 OK")
+		case "PROT":
+			protected = argument == "P"
+			reply("200 OK")
+		case "EPSV", "PASV":
+			if data != nil {
+				data.Close()
+			}
+			if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				reply("425 Can't open data connection")
+				continue
+			}
+			port := data.Addr().(*net.TCPAddr).Port
+			if command == "EPSV" {
+				reply("229 Entering Extended Passive Mode (|||%d|)", port)
+			} else {
+				reply("227 Entering Passive Mode (127,0,0,1,%d,%d)", port/256, port%256)
+			}
+		case "RETR":
+			file, err := os.Open(filepath.Join(s.root, filepath.Base(argument)))
+			if !loggedIn || data == nil || err != nil {
+				reply("550 File unavailable")
+				continue
+			}
+			reply("150 Opening data connection")
+			dataConn, err := data.Accept()
+			if err == nil {
+				if protected {
+					dataConn = tls.Server(dataConn, s.tlsConfig)
+				}
+				io.Copy(dataConn, file) //nolint:errcheck
+				dataConn.Close()
+			}
+			file.Close()
+			reply("226 Transfer complete")
+		case "QUIT":
+			reply("221 Goodbye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestGetFTPFile(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	server := newFakeFtpServer(t, nil, false)
+	defer server.Close()
+
+	uri, err := url.Parse(fmt.Sprintf("ftp://sytral:pass@%s/oneline.txt", server.Addr()))
+	require.Nil(err)
+	reader, err := getFile(*uri, defaultOptions)
+	require.Nil(err)
+	b, err := ioutil.ReadAll(reader)
+	require.Nil(err)
+	assert.Equal(oneline, string(b))
+
+	options := defaultOptions
+	options.FTP.DisableEPSV = true
+	reader, err = getFile(*uri, options)
+	require.Nil(err)
+	b, err = ioutil.ReadAll(reader)
+	require.Nil(err)
+	assert.Equal(oneline, string(b))
+
+	var manager DataManager
+	err = RefreshDeparturesWithOptions(&manager, *uri, defaultOptions)
+	require.Nil(err)
+	departures, err := manager.GetDeparturesByStops([]string{"1"})
+	require.Nil(err)
+	assert.Len(departures, 1)
+}
+
+func TestGetFTPFileError(t *testing.T) {
+	require := require.New(t)
+
+	server := newFakeFtpServer(t, nil, false)
+	defer server.Close()
+
+	uri, err := url.Parse(fmt.Sprintf("ftp://sytral:wrongpass@%s/oneline.txt", server.Addr()))
+	require.Nil(err)
+	_, err = getFile(*uri, defaultOptions)
+	require.Error(err)
+
+	uri, err = url.Parse(fmt.Sprintf("ftp://sytral:pass@%s/not.txt", server.Addr()))
+	require.Nil(err)
+	_, err = getFile(*uri, defaultOptions)
+	require.Error(err)
+
+	uri, err = url.Parse(fmt.Sprintf("ftp://sytral:pass@%s/oneline.txt", server.Addr()))
+	require.Nil(err)
+	server.Close()
+	_, err = getFile(*uri, defaultOptions)
+	require.Error(err)
+}
+
+func TestGetFTPSFile(t *testing.T) {
+	cert, caFile := newTestCertificate(t)
+	defer os.Remove(caFile)
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	for _, implicitTLS := range []bool{false, true} {
+		t.Run(fmt.Sprintf("implicit=%t", implicitTLS), func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+
+			server := newFakeFtpServer(t, tlsConfig, implicitTLS)
+			defer server.Close()
+
+			uri, err := url.Parse(fmt.Sprintf("ftps://sytral:pass@%s/oneline.txt", server.Addr()))
+			require.Nil(err)
+			options := defaultOptions
+			options.FTP.ImplicitTLS = implicitTLS
+
+			// the certificate of the test server isn't trusted by default
+			_, err = getFile(*uri, options)
+			require.Error(err)
+
+			options.TLS.CAFile = caFile
+			reader, err := getFile(*uri, options)
+			require.Nil(err)
+			b, err := ioutil.ReadAll(reader)
+			require.Nil(err)
+			assert.Equal(oneline, string(b))
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package sytralrt
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/sirupsen/logrus"
+)
+
+// GlobOptions defines how the file of a source is chosen when its path is a glob pattern
+type GlobOptions struct {
+	// NameTimestampLayout orders the matching files by the timestamp found in their name instead of their
+	// modification time, it is a time.Parse layout like 20060102T1504. Files without such a timestamp are ignored.
+	NameTimestampLayout string
+	// MoveProcessed moves the matching files older than the one loaded to a processed directory next to them
+	MoveProcessed bool
+}
+
+// processedDir is the directory, relative to the matching files, where the old ones are moved
+const processedDir = "processed"
+
+// isGlobSource returns true if the path of uri is a pattern, only file and sftp sources can list their files
+func isGlobSource(uri url.URL) bool {
+	return (uri.Scheme == "file" || uri.Scheme == "sftp") && strings.ContainsAny(uri.Path, "*?[")
+}
+
+type globMatch struct {
+	path      string
+	timestamp time.Time
+}
+
+// timestampInName returns the first timestamp of the given layout found in name
+func timestampInName(name, layout string) (time.Time, bool) {
+	for i := 0; i+len(layout) <= len(name); i++ {
+		if t, err := time.Parse(layout, name[i:i+len(layout)]); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// sortMatches orders the matching files from the newest to the oldest, directories are ignored
+func sortMatches(paths []string, stat func(string) (os.FileInfo, error), options GlobOptions) ([]globMatch, error) {
+	matches := make([]globMatch, 0, len(paths))
+	for _, p := range paths {
+		info, err := stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		timestamp := info.ModTime()
+		if options.NameTimestampLayout != "" {
+			var ok bool
+			if timestamp, ok = timestampInName(path.Base(p), options.NameTimestampLayout); !ok {
+				continue
+			}
+		}
+		matches = append(matches, globMatch{path: p, timestamp: timestamp})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].timestamp.Equal(matches[j].timestamp) {
+			return matches[i].path > matches[j].path
+		}
+		return matches[i].timestamp.After(matches[j].timestamp)
+	})
+	return matches, nil
+}
+
+// resolveGlob returns the uri of the newest file matching the pattern of uri, and the paths of the older ones
+func resolveGlob(uri url.URL, options FetchOptions) (url.URL, []string, error) {
+	var matches []globMatch
+	var err error
+	if uri.Scheme == "sftp" {
+		err = withSftpClient(uri, options, func(client *sftp.Client) error {
+			paths, err := client.Glob(uri.Path)
+			if err != nil {
+				return err
+			}
+			matches, err = sortMatches(paths, client.Stat, options.Glob)
+			return err
+		})
+	} else {
+		var paths []string
+		if paths, err = filepath.Glob(uri.Path); err == nil {
+			matches, err = sortMatches(paths, os.Stat, options.Glob)
+		}
+	}
+	if err != nil {
+		return url.URL{}, nil, err
+	}
+	if len(matches) == 0 {
+		return url.URL{}, nil, fmt.Errorf("no file matching %s", uri.Path)
+	}
+
+	var older []string
+	for _, match := range matches[1:] {
+		older = append(older, match.path)
+	}
+	uri.Path = matches[0].path
+	return uri, older, nil
+}
+
+// moveProcessedFiles moves the files older than the one just loaded to the processed directory,
+// the load is not affected by a failure
+func moveProcessedFiles(metadata fileMetadata, options FetchOptions) {
+	if !options.Glob.MoveProcessed || len(metadata.older) == 0 {
+		return
+	}
+	uri, err := url.Parse(metadata.uri)
+	if err != nil {
+		return
+	}
+	move := func(mkdirAll func(string) error, rename func(string, string) error) error {
+		for _, p := range metadata.older {
+			dir := path.Join(path.Dir(p), processedDir)
+			if err := mkdirAll(dir); err != nil {
+				return err
+			}
+			if err := rename(p, path.Join(dir, path.Base(p))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if uri.Scheme == "sftp" {
+		err = withSftpClient(*uri, options, func(client *sftp.Client) error {
+			return move(client.MkdirAll, client.Rename)
+		})
+	} else {
+		err = move(func(dir string) error { return os.MkdirAll(dir, 0755) }, os.Rename)
+	}
+	if err != nil {
+		logrus.Warnf("unable to move the processed files of %s: %s", RedactURI(*uri), err)
+	}
+}
@@ -0,0 +1,137 @@
+package sytralrt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGlobDir creates a directory with the given fixtures, named after the keys and modified at the given times
+func newGlobDir(t *testing.T, files map[string]string, modTimes map[string]time.Time) string {
+	dir, err := ioutil.TempDir("", "sytralrt-glob")
+	require.Nil(t, err)
+	for name, fixture := range files {
+		copyFixture(t, fixture, filepath.Join(dir, name), modTimes[name])
+	}
+	return dir
+}
+
+func TestGlobSourcePicksNewestModifiedFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	now := time.Now()
+	dir := newGlobDir(t,
+		map[string]string{"extract_b.txt": "first.txt", "extract_a.txt": "second.txt", "other.txt": "oneline.txt"},
+		map[string]time.Time{"extract_b.txt": now.Add(-time.Hour), "extract_a.txt": now, "other.txt": now.Add(time.Hour)})
+	defer os.RemoveAll(dir)
+	// a directory matching the pattern is ignored
+	require.Nil(os.Mkdir(filepath.Join(dir, "extract_dir.txt"), 0755))
+
+	uri, err := url.Parse(fmt.Sprintf("file://%s/extract_*.txt", dir))
+	require.Nil(err)
+	reader, metadata, err := getFileIfModified(*uri, defaultOptions, fileMetadata{})
+	require.Nil(err)
+	b, err := ioutil.ReadAll(reader)
+	require.Nil(err)
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "extract_a.txt"))
+	require.Nil(err)
+	assert.Equal(string(expected), string(b))
+	assert.Equal(fmt.Sprintf("file://%s/extract_a.txt", dir), metadata.uri)
+	assert.Equal([]string{filepath.Join(dir, "extract_b.txt")}, metadata.older)
+
+	_, _, err = getFileIfModified(*uri, defaultOptions, metadata)
+	assert.Equal(ErrNotModified, err)
+
+	uri, err = url.Parse(fmt.Sprintf("file://%s/missing_*.txt", dir))
+	require.Nil(err)
+	_, _, err = getFileIfModified(*uri, defaultOptions, fileMetadata{})
+	assert.Error(err)
+}
+
+func TestGlobSourceByNameTimestamp(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	now := time.Now()
+	dir := newGlobDir(t,
+		map[string]string{
+			"extract_edylic_20181017T1200.txt": "first.txt",
+			"extract_edylic_20181017T1100.txt": "second.txt",
+			"extract_edylic_latest.txt":        "oneline.txt",
+		},
+		map[string]time.Time{
+			"extract_edylic_20181017T1200.txt": now.Add(-time.Hour),
+			"extract_edylic_20181017T1100.txt": now,
+			"extract_edylic_latest.txt":        now,
+		})
+	defer os.RemoveAll(dir)
+
+	uri, err := url.Parse(fmt.Sprintf("file://%s/extract_edylic_*.txt", dir))
+	require.Nil(err)
+	options := defaultOptions
+	options.Glob.NameTimestampLayout = "20060102T1504"
+	options.Glob.MoveProcessed = true
+
+	var manager DataManager
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+	departures, err := manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 4)
+
+	// the older file has been moved, the one without timestamp is left alone
+	_, err = os.Stat(filepath.Join(dir, processedDir, "extract_edylic_20181017T1100.txt"))
+	assert.Nil(err)
+	for _, name := range []string{"extract_edylic_20181017T1200.txt", "extract_edylic_latest.txt"} {
+		_, err = os.Stat(filepath.Join(dir, name))
+		assert.Nil(err)
+	}
+
+	// once a newer file is dropped, the previous one is moved too
+	copyFixture(t, "second.txt", filepath.Join(dir, "extract_edylic_20181017T1300.txt"), now.Add(-2*time.Hour))
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+	departures, err = manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 3)
+	_, err = os.Stat(filepath.Join(dir, processedDir, "extract_edylic_20181017T1200.txt"))
+	assert.Nil(err)
+}
+
+func TestTimestampInName(t *testing.T) {
+	timestamp, ok := timestampInName("extract_edylic_20181017T1200.txt", "20060102T1504")
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2018, 10, 17, 12, 0, 0, 0, time.UTC), timestamp)
+
+	_, ok = timestampInName("extract_edylic.txt", "20060102T1504")
+	assert.False(t, ok)
+}
+
+func TestSFTPGlobSource(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	now := time.Now()
+	dir := newGlobDir(t,
+		map[string]string{"extract_1.txt": "first.txt", "extract_2.txt": "oneline.txt"},
+		map[string]time.Time{"extract_1.txt": now.Add(-time.Hour), "extract_2.txt": now})
+	defer os.RemoveAll(dir)
+	server := newFakeSftpServer(t, nil)
+	defer server.Close()
+
+	uri, err := url.Parse(fmt.Sprintf("sftp://sytral:pass@%s%s/extract_*.txt", server.Addr(), dir))
+	require.Nil(err)
+	options := defaultOptions
+	options.Glob.MoveProcessed = true
+	assert.Equal(oneline, readFetchedFile(t, *uri, options))
+
+	var manager DataManager
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+	_, err = os.Stat(filepath.Join(dir, processedDir, "extract_1.txt"))
+	assert.Nil(err)
+	_, err = os.Stat(filepath.Join(dir, "extract_2.txt"))
+	assert.Nil(err)
+}
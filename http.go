@@ -0,0 +1,137 @@
+package sytralrt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// TLSOptions defines how the TLS connections to a data source are established
+type TLSOptions struct {
+	CAFile             string // PEM bundle used to verify the server, system pool if empty
+	CertFile           string // PEM client certificate, requires KeyFile
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+func newTLSConfig(options TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: options.InsecureSkipVerify, //nolint:gosec
+	}
+
+	if options.CAFile != "" {
+		pem, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func newHTTPTransport(options FetchOptions) (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(options.TLS)
+	if err != nil {
+		return nil, err
+	}
+	proxy := http.ProxyFromEnvironment
+	if options.Proxy != "" {
+		proxyURL, err := url.Parse(options.Proxy)
+		if err != nil {
+			return nil, errInvalidURL("proxy")
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout: options.ConnectionTimeout,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   options.ConnectionTimeout,
+		ResponseHeaderTimeout: options.ConnectionTimeout,
+	}, nil
+}
+
+func getFileWithHTTP(uri url.URL, options FetchOptions, previous Metadata) (io.ReadCloser, Metadata, error) {
+	uri, err := withCredentials(uri, options.Credentials)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	// the credentials are sent as basic auth, not as part of the url
+	user := uri.User
+	uri.User = nil
+	request, err := http.NewRequest(http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	for name, values := range options.HTTPHeaders {
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+	}
+	if user != nil {
+		password, _ := user.Password()
+		request.SetBasicAuth(user.Username(), password)
+	}
+	return getConditionally(request, options, previous)
+}
+
+// getConditionally sends a GET request, conditional if there is a previous version of the file.
+// ErrNotModified is returned if the server answers that the file hasn't changed.
+func getConditionally(request *http.Request, options FetchOptions, previous Metadata) (io.ReadCloser, Metadata, error) {
+	transport, err := newHTTPTransport(options)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	client := &http.Client{Transport: transport}
+
+	if previous.Version != "" {
+		request.Header.Set("If-None-Match", previous.Version)
+	}
+	if !previous.ModTime.IsZero() {
+		request.Header.Set("If-Modified-Since", previous.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	body := readCloser{Reader: response.Body, Closer: closerFunc(func() error {
+		err := response.Body.Close()
+		transport.CloseIdleConnections()
+		return err
+	})}
+	if response.StatusCode == http.StatusNotModified {
+		body.Close()
+		return nil, previous, ErrNotModified
+	}
+	if response.StatusCode != http.StatusOK {
+		body.Close()
+		return nil, Metadata{}, fmt.Errorf("Unexpected http status %s for %s", response.Status, request.URL.String())
+	}
+
+	metadata := Metadata{Size: response.ContentLength, Version: response.Header.Get("ETag")}
+	if lastModified, err := http.ParseTime(response.Header.Get("Last-Modified")); err == nil {
+		metadata.ModTime = lastModified
+	}
+	return body, metadata, nil
+}
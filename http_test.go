@@ -0,0 +1,154 @@
+package sytralrt
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFixtureHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "sytral" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join(fixtureDir, filepath.Base(r.URL.Path)))
+	})
+}
+
+func TestGetHTTPFile(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	server := httptest.NewServer(newFixtureHandler())
+	defer server.Close()
+
+	options := defaultOptions
+	options.HTTPHeaders = http.Header{"X-Api-Key": []string{"secret"}}
+
+	uri, err := url.Parse(fmt.Sprintf("http://sytral:pass@%s/oneline.txt", server.Listener.Addr()))
+	require.Nil(err)
+	reader, err := getFile(*uri, options)
+	require.Nil(err)
+	b, err := ioutil.ReadAll(reader)
+	require.Nil(err)
+	assert.Equal(oneline, string(b))
+
+	var manager DataManager
+	err = RefreshDeparturesWithOptions(&manager, *uri, options)
+	require.Nil(err)
+	departures, err := manager.GetDeparturesByStops([]string{"1"})
+	require.Nil(err)
+	assert.Len(departures, 1)
+}
+
+func TestGetHTTPFileError(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(newFixtureHandler())
+	defer server.Close()
+
+	options := defaultOptions
+	options.HTTPHeaders = http.Header{"X-Api-Key": []string{"secret"}}
+
+	uri, err := url.Parse(fmt.Sprintf("http://sytral:wrongpass@%s/oneline.txt", server.Listener.Addr()))
+	require.Nil(err)
+	_, err = getFile(*uri, options)
+	require.Error(err)
+
+	uri, err = url.Parse(fmt.Sprintf("http://sytral:pass@%s/oneline.txt", server.Listener.Addr()))
+	require.Nil(err)
+	_, err = getFile(*uri, defaultOptions)
+	require.Error(err)
+
+	uri, err = url.Parse(fmt.Sprintf("http://sytral:pass@%s/not.txt", server.Listener.Addr()))
+	require.Nil(err)
+	_, err = getFile(*uri, options)
+	require.Error(err)
+}
+
+func TestGetHTTPSFile(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	server := httptest.NewTLSServer(newFixtureHandler())
+	defer server.Close()
+
+	uri, err := url.Parse(fmt.Sprintf("https://sytral:pass@%s/oneline.txt", server.Listener.Addr()))
+	require.Nil(err)
+
+	options := defaultOptions
+	options.HTTPHeaders = http.Header{"X-Api-Key": []string{"secret"}}
+
+	// the certificate of the test server isn't trusted by default
+	_, err = getFile(*uri, options)
+	require.Error(err)
+
+	caFile, err := ioutil.TempFile("", "sytralrt-ca")
+	require.Nil(err)
+	defer os.Remove(caFile.Name())
+	err = pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.Nil(err)
+	require.Nil(caFile.Close())
+
+	options.TLS.CAFile = caFile.Name()
+	reader, err := getFile(*uri, options)
+	require.Nil(err)
+	b, err := ioutil.ReadAll(reader)
+	require.Nil(err)
+	assert.Equal(oneline, string(b))
+}
+
+func TestGetHTTPFileIfModified(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	etag := `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/etag.txt" {
+			w.Header().Set("ETag", etag)
+		}
+		http.ServeFile(w, r, filepath.Join(fixtureDir, "oneline.txt"))
+	}))
+	defer server.Close()
+
+	// Last-Modified and If-Modified-Since
+	uri, err := url.Parse(fmt.Sprintf("%s/oneline.txt", server.URL))
+	require.Nil(err)
+	_, metadata, err := getFileIfModified(*uri, defaultOptions, fileMetadata{})
+	require.Nil(err)
+	assert.False(metadata.ModTime.IsZero())
+	_, _, err = getFileIfModified(*uri, defaultOptions, metadata)
+	assert.Equal(ErrNotModified, err)
+
+	// ETag and If-None-Match
+	uri, err = url.Parse(fmt.Sprintf("%s/etag.txt", server.URL))
+	require.Nil(err)
+	_, metadata, err = getFileIfModified(*uri, defaultOptions, fileMetadata{})
+	require.Nil(err)
+	assert.Equal(etag, metadata.Version)
+	_, _, err = getFileIfModified(*uri, defaultOptions, metadata)
+	assert.Equal(ErrNotModified, err)
+
+	etag = `"v2"`
+	reader, metadata, err := getFileIfModified(*uri, defaultOptions, metadata)
+	require.Nil(err)
+	assert.Equal(etag, metadata.Version)
+	b, err := ioutil.ReadAll(reader)
+	require.Nil(err)
+	assert.Equal(oneline, string(b))
+}
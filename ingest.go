@@ -0,0 +1,208 @@
+package sytralrt
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultMaxIngestSize caps the size of the files pushed to /ingest if IngestOptions.MaxSize isn't set
+const DefaultMaxIngestSize = 100 << 20
+
+// ingestSource is the source reported by /status for the datasets pushed to /ingest
+const ingestSource = "ingest"
+
+// IngestOptions defines who can push data files to the /ingest endpoints
+type IngestOptions struct {
+	// Tokens are the bearer tokens accepted, the endpoints aren't available without any
+	Tokens  []string
+	MaxSize int64
+	// Feeds are the options of the refreshes of each feed, their pushed files are parsed the same way
+	Feeds map[string]FetchOptions
+}
+
+// IngestReport defines the structure returned by the /ingest endpoints
+type IngestReport struct {
+	Feed    string        `json:"feed,omitempty"`
+	Loaded  bool          `json:"loaded"`
+	Records int           `json:"records"`
+	Errors  []IngestError `json:"errors,omitempty"`
+	// SanityRejection is set when the file has been parsed but failed a sanity check of the feed
+	SanityRejection *SanityRejection `json:"sanity_rejection,omitempty"`
+	// Rejections lists the records skipped in lenient mode
+	Rejections *RejectionReport `json:"rejections,omitempty"`
+}
+
+// IngestError locates an error of a pushed file, Line and Column are 0 when unknown.
+// Path locates the errors of the equipments documents, like /root/donnees/ligne[1]/@code.
+type IngestError struct {
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// newIngestError extracts the position of an error from the errors of the parsers
+func newIngestError(err error) IngestError {
+	switch e := err.(type) {
+	case *LineError:
+		return IngestError{Line: e.Line, Message: e.Err.Error()}
+	case *csv.ParseError:
+		return IngestError{Line: e.Line, Column: e.Column, Message: e.Err.Error()}
+	case *xml.SyntaxError:
+		return IngestError{Line: e.Line, Message: e.Msg}
+	case *XMLPathError:
+		return IngestError{Path: e.Path, Message: e.Err.Error()}
+	default:
+		return IngestError{Message: err.Error()}
+	}
+}
+
+// Ingest loads a data file pushed for a feed and swaps it with the current dataset.
+// It returns the number of records loaded, the current dataset is kept if the file can't be loaded.
+func Ingest(manager *DataManager, feed string, file io.Reader) (int, error) {
+	return IngestWithOptions(manager, feed, file, FetchOptions{})
+}
+
+// IngestWithOptions loads a pushed file with the options of its feed: its columns, charset, timezone,
+// lenient mode and sanity checks are the ones of the files fetched by its refreshes
+func IngestWithOptions(manager *DataManager, feed string, file io.Reader, options FetchOptions) (int, error) {
+	return ingestFile(manager, feed, file, options, newRejectionReport(options.Lenient))
+}
+
+// ingestFile loads a pushed file, collecting its invalid records in rejections if it isn't nil
+func ingestFile(manager *DataManager, feed string, file io.Reader, options FetchOptions,
+	rejections *RejectionReport) (int, error) {
+	metadata := fileMetadata{uri: ingestSource}
+	switch feed {
+	case "departures":
+		departures, err := loadDepartures(file, options, rejections)
+		manager.reportRejections(feed, rejections)
+		if err != nil {
+			return 0, err
+		}
+		if err = manager.checkDepartures(departures, metadata, options.Sanity); err != nil {
+			return 0, err
+		}
+		manager.updateDepartures(departures, metadata)
+		count := 0
+		for _, stopDepartures := range departures {
+			count += len(stopDepartures)
+		}
+		return count, nil
+	case "parkings":
+		parkings, err := loadParkings(file, options, rejections)
+		manager.reportRejections(feed, rejections)
+		if err != nil {
+			return 0, err
+		}
+		if err = manager.checkParkings(parkings, options.Sanity); err != nil {
+			return 0, err
+		}
+		manager.updateParkings(parkings, metadata)
+		return len(parkings), nil
+	case "equipments":
+		equipments, err := loadEquipments(file, options, rejections)
+		manager.reportRejections(feed, rejections)
+		if err != nil {
+			return 0, err
+		}
+		if err = manager.checkEquipments(equipments, options.Sanity); err != nil {
+			return 0, err
+		}
+		manager.updateEquipments(equipments, metadata)
+		return len(equipments), nil
+	default:
+		return 0, fmt.Errorf("unknown feed %s", feed)
+	}
+}
+
+// IngestHandler loads the file sent as the body of the request, or as the "file" field of a multipart form.
+// The file may be compressed with gzip, bzip2 or zip.
+func IngestHandler(manager *DataManager, feed string, options IngestOptions) gin.HandlerFunc {
+	maxSize := options.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxIngestSize
+	}
+	return func(c *gin.Context) {
+		report := IngestReport{Feed: feed}
+		fail := func(code int, err error) {
+			report.Errors = append(report.Errors, newIngestError(err))
+			c.JSON(code, report)
+		}
+
+		var body io.Reader = c.Request.Body
+		name := ""
+		if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+			file, header, err := c.Request.FormFile("file")
+			if err != nil {
+				fail(http.StatusBadRequest, err)
+				return
+			}
+			defer file.Close()
+			body, name = file, header.Filename
+		}
+		capped := &cappedReader{reader: body, what: "pushed file", max: maxSize}
+		reader, err := decompress(name, capped, DefaultMaxDecompressedSize)
+		if err != nil {
+			fail(http.StatusBadRequest, err)
+			return
+		}
+
+		feedOptions := options.Feeds[feed]
+		report.Rejections = newRejectionReport(feedOptions.Lenient)
+		report.Records, err = ingestFile(manager, feed, reader, feedOptions, report.Rejections)
+		if capped.read > capped.max {
+			fail(http.StatusRequestEntityTooLarge, fmt.Errorf("%s exceeds %d bytes", capped.what, capped.max))
+			return
+		} else if sanityErr, ok := err.(*SanityError); ok {
+			report.SanityRejection = &sanityErr.SanityRejection
+			fail(http.StatusUnprocessableEntity, err)
+			return
+		} else if err != nil {
+			fail(http.StatusUnprocessableEntity, err)
+			return
+		}
+		report.Loaded = true
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// requireToken rejects the requests without one of the bearer tokens in their Authorization header
+func requireToken(tokens []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if strings.HasPrefix(header, "Bearer ") {
+			token := []byte(strings.TrimPrefix(header, "Bearer "))
+			for _, expected := range tokens {
+				if subtle.ConstantTimeCompare(token, []byte(expected)) == 1 {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.Header("WWW-Authenticate", `Bearer realm="sytralrt"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, IngestReport{
+			Errors: []IngestError{{Message: "missing or invalid bearer token"}},
+		})
+	}
+}
+
+// SetupIngestRoutes adds the authenticated POST /ingest/{departures,parkings,equipments} endpoints,
+// unless no token is configured
+func SetupIngestRoutes(manager *DataManager, r *gin.Engine, options IngestOptions) {
+	if len(options.Tokens) == 0 {
+		return
+	}
+	ingest := r.Group("/ingest", requireToken(options.Tokens))
+	for _, feed := range []string{"departures", "parkings", "equipments"} {
+		ingest.POST("/"+feed, IngestHandler(manager, feed, options))
+	}
+}
@@ -0,0 +1,230 @@
+package sytralrt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func readFixture(t *testing.T, fixture string) []byte {
+	content, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", fixtureDir, fixture))
+	require.Nil(t, err)
+	return content
+}
+
+// ingest pushes a file to an /ingest endpoint and returns the status code and the report
+func ingest(t *testing.T, engine *gin.Engine, request *http.Request) (int, IngestReport) {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, request)
+	var report IngestReport
+	if w.Code != http.StatusNotFound {
+		require.Nil(t, json.Unmarshal(w.Body.Bytes(), &report), w.Body.String())
+	}
+	return w.Code, report
+}
+
+func newIngestRequest(feed string, body []byte, token string) *http.Request {
+	request := httptest.NewRequest("POST", "/ingest/"+feed, bytes.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return request
+}
+
+func TestIngestApi(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var manager DataManager
+	engine := SetupRouter(&manager, gin.New())
+	SetupIngestRoutes(&manager, engine, IngestOptions{Tokens: []string{"first", "second"}})
+
+	code, report := ingest(t, engine, newIngestRequest("departures", readFixture(t, "first.txt"), ""))
+	assert.Equal(http.StatusUnauthorized, code)
+	assert.Len(report.Errors, 1)
+	code, _ = ingest(t, engine, newIngestRequest("departures", readFixture(t, "first.txt"), "third"))
+	assert.Equal(http.StatusUnauthorized, code)
+
+	code, report = ingest(t, engine, newIngestRequest("departures", readFixture(t, "first.txt"), "second"))
+	require.Equal(http.StatusOK, code)
+	assert.Equal(IngestReport{Feed: "departures", Loaded: true, Records: 4}, report)
+	departures, err := manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 4)
+
+	// the current dataset is kept when the pushed file is invalid
+	code, report = ingest(t, engine, newIngestRequest("departures", readFixture(t, "invaliddate.txt"), "first"))
+	require.Equal(http.StatusUnprocessableEntity, code)
+	assert.False(report.Loaded)
+	require.Len(report.Errors, 1)
+	assert.Equal(1, report.Errors[0].Line)
+	assert.Contains(report.Errors[0].Message, "28:38:37")
+	departures, err = manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 4)
+
+	code, report = ingest(t, engine, newIngestRequest("departures", readFixture(t, "missingfield.txt"), "first"))
+	require.Equal(http.StatusUnprocessableEntity, code)
+	require.Len(report.Errors, 1)
+	assert.Equal(2, report.Errors[0].Line)
+
+	code, report = ingest(t, engine, newIngestRequest("equipments", readFixture(t, "NET_ACCESS.XML"), "first"))
+	require.Equal(http.StatusOK, code)
+	assert.Equal(3, report.Records)
+	equipments, err := manager.GetEquipments()
+	require.Nil(err)
+	assert.Len(equipments, 3)
+
+	code, report = ingest(t, engine, newIngestRequest("equipments", []byte("<root>\n<donnees>\n</root>"), "first"))
+	require.Equal(http.StatusUnprocessableEntity, code)
+	require.Len(report.Errors, 1)
+	assert.Equal(3, report.Errors[0].Line)
+}
+
+func TestIngestMultipartCompressedFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var manager DataManager
+	engine := SetupRouter(&manager, gin.New())
+	SetupIngestRoutes(&manager, engine, IngestOptions{Tokens: []string{"secret"}})
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "parkings.txt.gz")
+	require.Nil(err)
+	_, err = part.Write(gzipped(t, readFixture(t, "parkings.txt")))
+	require.Nil(err)
+	require.Nil(writer.Close())
+	request := newIngestRequest("parkings", body.Bytes(), "secret")
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	code, report := ingest(t, engine, request)
+	require.Equal(http.StatusOK, code, report)
+	assert.Equal(19, report.Records)
+	parkings, err := manager.GetParkings()
+	require.Nil(err)
+	assert.Len(parkings, 19)
+}
+
+func TestIngestTooLargeFile(t *testing.T) {
+	var manager DataManager
+	engine := SetupRouter(&manager, gin.New())
+	SetupIngestRoutes(&manager, engine, IngestOptions{Tokens: []string{"secret"}, MaxSize: 100})
+
+	code, report := ingest(t, engine, newIngestRequest("departures", readFixture(t, "first.txt"), "secret"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	assert.False(t, report.Loaded)
+	_, err := manager.GetDeparturesByStops([]string{"3"})
+	assert.Error(t, err)
+}
+
+func TestIngestWithFeedTimezone(t *testing.T) {
+	location, err := time.LoadLocation("America/Montreal")
+	require.Nil(t, err)
+	var manager DataManager
+	engine := SetupRouter(&manager, gin.New())
+	SetupIngestRoutes(&manager, engine, IngestOptions{Tokens: []string{"secret"}, Feeds: map[string]FetchOptions{
+		"departures": {Location: location},
+	}})
+
+	code, report := ingest(t, engine, newIngestRequest("departures", []byte(oneline), "secret"))
+	require.Equal(t, http.StatusOK, code, report)
+	departures, err := manager.GetDeparturesByStops([]string{"1"})
+	require.Nil(t, err)
+	require.Len(t, departures, 1)
+	assert.Equal(t, time.Date(2018, 9, 17, 20, 28, 0, 0, location), departures[0].Datetime)
+}
+
+func TestIngestWithFeedColumns(t *testing.T) {
+	var manager DataManager
+	engine := SetupRouter(&manager, gin.New())
+	SetupIngestRoutes(&manager, engine, IngestOptions{Tokens: []string{"secret"}, Feeds: map[string]FetchOptions{
+		"departures": {Columns: ColumnMapping{"direction_name": {Index: 3}}},
+	}})
+
+	// the direction name is read from the 4th column
+	content := "1;87A;11 min;Mions Bourdelle;E;2018-09-17 20:28:00;35998\n"
+	code, report := ingest(t, engine, newIngestRequest("departures", []byte(content), "secret"))
+	require.Equal(t, http.StatusOK, code, report)
+	departures, err := manager.GetDeparturesByStops([]string{"1"})
+	require.Nil(t, err)
+	require.Len(t, departures, 1)
+	assert.Equal(t, "Mions Bourdelle", departures[0].DirectionName)
+}
+
+func TestIngestWithFeedCharset(t *testing.T) {
+	var manager DataManager
+	engine := SetupRouter(&manager, gin.New())
+	SetupIngestRoutes(&manager, engine, IngestOptions{Tokens: []string{"secret"}, Feeds: map[string]FetchOptions{
+		"departures": {Charset: charmap.ISO8859_1},
+	}})
+
+	content := encode(t, charmap.ISO8859_1, decinesDeparture)
+	code, report := ingest(t, engine, newIngestRequest("departures", []byte(content), "secret"))
+	require.Equal(t, http.StatusOK, code, report)
+	departures, err := manager.GetDeparturesByStops([]string{"1"})
+	require.Nil(t, err)
+	require.Len(t, departures, 1)
+	assert.Equal(t, "Décines Centre", departures[0].DirectionName)
+}
+
+func TestIngestLenient(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var manager DataManager
+	engine := SetupRouter(&manager, gin.New())
+	SetupIngestRoutes(&manager, engine, IngestOptions{Tokens: []string{"secret"}, Feeds: map[string]FetchOptions{
+		"departures": {Lenient: LenientOptions{Enabled: true}},
+	}})
+
+	// the 2nd line has an invalid date
+	content := oneline + "1;87A;Mions Bourdelle;11 min;E;2018-09-17 28:28:00;35998\n"
+	code, report := ingest(t, engine, newIngestRequest("departures", []byte(content), "secret"))
+	require.Equal(http.StatusOK, code, report)
+	assert.True(report.Loaded)
+	assert.Equal(1, report.Records)
+	require.Contains(manager.GetRejections(), "departures")
+	assert.Len(manager.GetRejections()["departures"].Rejected, 1)
+
+	// the skipped records are reported to the pusher
+	require.NotNil(report.Rejections)
+	assert.Equal(2, report.Rejections.Records)
+	assert.Equal(1, report.Rejections.RejectedCount)
+	require.Len(report.Rejections.Rejected, 1)
+	assert.Equal(2, report.Rejections.Rejected[0].Line)
+	assert.Equal("invalid_date", report.Rejections.Rejected[0].Reason)
+
+	// and so are they when there are too many of them
+	engine = SetupRouter(&manager, gin.New())
+	SetupIngestRoutes(&manager, engine, IngestOptions{Tokens: []string{"secret"}, Feeds: map[string]FetchOptions{
+		"departures": {Lenient: LenientOptions{Enabled: true, MaxRejectedRatio: 0.1}},
+	}})
+	code, report = ingest(t, engine, newIngestRequest("departures", []byte(content), "secret"))
+	require.Equal(http.StatusUnprocessableEntity, code, report)
+	assert.False(report.Loaded)
+	require.NotNil(report.Rejections)
+	assert.Equal(1, report.Rejections.RejectedCount)
+	assert.NotEmpty(report.Rejections.Error)
+}
+
+func TestIngestDisabledWithoutToken(t *testing.T) {
+	var manager DataManager
+	engine := SetupRouter(&manager, gin.New())
+	SetupIngestRoutes(&manager, engine, IngestOptions{})
+
+	code, _ := ingest(t, engine, newIngestRequest("departures", readFixture(t, "first.txt"), ""))
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,149 @@
+package sytralrt
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var rejectedRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sytralrt",
+	Name:      "rejected_records",
+	Help:      "number of invalid records skipped by the lenient loads",
+}, []string{"feed", "reason"})
+
+func init() {
+	prometheus.MustRegister(rejectedRecords)
+}
+
+// MaxRejectedRecords caps the number of rejected records listed by a RejectionReport,
+// the next ones are only counted
+const MaxRejectedRecords = 1000
+
+// LenientOptions makes the invalid records of a file skipped instead of failing its whole load
+type LenientOptions struct {
+	Enabled bool
+	// MaxRejected fails the whole load if more records are invalid, there is no limit if 0
+	MaxRejected int
+	// MaxRejectedRatio fails the whole load if a bigger part of the records is invalid, there is no limit if 0
+	MaxRejectedRatio float64
+}
+
+// RejectedRecord is a record skipped by a lenient load
+type RejectedRecord struct {
+	Line    int    `json:"line,omitempty"`
+	ID      string `json:"id,omitempty"` // for the equipments, which aren't read line by line
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// RejectionReport lists the records rejected by the last lenient load of a feed
+type RejectionReport struct {
+	LoadedAt time.Time `json:"loaded_at"`
+	Records  int       `json:"records"`
+	// RejectedCount is the number of rejected records, only the first MaxRejectedRecords are in Rejected
+	RejectedCount int              `json:"rejected_count"`
+	Rejected      []RejectedRecord `json:"rejected"`
+	// Error is set when too many records have been rejected, the whole file has then been rejected
+	Error string `json:"error,omitempty"`
+
+	options LenientOptions
+	// reasons counts the rejected records by reason, including the ones not listed
+	reasons map[string]int
+}
+
+// newRejectionReport returns the report collecting the rejected records of a load, nil if it isn't lenient
+func newRejectionReport(options LenientOptions) *RejectionReport {
+	if !options.Enabled {
+		return nil
+	}
+	return &RejectionReport{LoadedAt: time.Now(), Rejected: []RejectedRecord{}, options: options,
+		reasons: make(map[string]int)}
+}
+
+// reject records an invalid record
+func (r *RejectionReport) reject(line int, id string, err error) {
+	reason := rejectionReason(err)
+	r.RejectedCount++
+	r.reasons[reason]++
+	if len(r.Rejected) < MaxRejectedRecords {
+		r.Rejected = append(r.Rejected, RejectedRecord{Line: line, ID: id, Reason: reason, Message: err.Error()})
+	}
+}
+
+// check fails if too many records have been rejected
+func (r *RejectionReport) check() error {
+	if r == nil || r.RejectedCount == 0 {
+		return nil
+	}
+	rejected := r.RejectedCount
+	if (r.options.MaxRejected > 0 && rejected > r.options.MaxRejected) ||
+		(r.options.MaxRejectedRatio > 0 && float64(rejected) > r.options.MaxRejectedRatio*float64(r.Records)) {
+		r.Error = fmt.Sprintf("%d of %d records rejected, above the threshold", rejected, r.Records)
+		return fmt.Errorf("too many invalid records: %s", r.Error)
+	}
+	return nil
+}
+
+// rejectionReason classifies why a record has been rejected, it is used as the label of the metric
+func rejectionReason(err error) string {
+	if lineErr, ok := err.(*LineError); ok {
+		err = lineErr.Err
+	}
+	if pathErr, ok := err.(*XMLPathError); ok {
+		err = pathErr.Err
+	}
+	if err == errMissingAttribute {
+		return "missing_field"
+	}
+	switch e := err.(type) {
+	case *csv.ParseError:
+		if e.Err == csv.ErrFieldCount {
+			return "field_count"
+		}
+		return "malformed"
+	case *missingFieldError:
+		return "missing_field"
+	case *time.ParseError:
+		return "invalid_date"
+	case *strconv.NumError:
+		return "invalid_number"
+	default:
+		return "invalid_record"
+	}
+}
+
+// reportRejections counts the records rejected by a lenient load and keeps its report for /admin/rejections
+func (d *DataManager) reportRejections(feed string, report *RejectionReport) {
+	if report == nil {
+		return
+	}
+	for reason, count := range report.reasons {
+		rejectedRecords.WithLabelValues(feed, reason).Add(float64(count))
+	}
+	if report.RejectedCount > 0 {
+		logrus.Warnf("%d of the %d %s records rejected", report.RejectedCount, report.Records, feed)
+	}
+
+	d.feedsMutex.Lock()
+	defer d.feedsMutex.Unlock()
+	d.feed(feed).rejections = report
+}
+
+// GetRejections returns the report of the last lenient load of each feed
+func (d *DataManager) GetRejections() map[string]*RejectionReport {
+	d.feedsMutex.RLock()
+	defer d.feedsMutex.RUnlock()
+
+	reports := make(map[string]*RejectionReport)
+	for name, feed := range d.feeds {
+		if feed.rejections != nil {
+			reports[name] = feed.rejections
+		}
+	}
+	return reports
+}
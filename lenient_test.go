@@ -0,0 +1,205 @@
+package sytralrt
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLenientDepartures(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	options := defaultOptions
+	options.Lenient = LenientOptions{Enabled: true, MaxRejectedRatio: 0.5}
+	tests := []struct {
+		fixture string
+		line    int
+		reason  string
+	}{
+		{"invaliddate.txt", 1, "invalid_date"},
+		// the number of fields isn't checked in lenient mode, the fields shifted by the missing one are invalid
+		{"missingfield.txt", 2, "invalid_date"},
+	}
+	for _, test := range tests {
+		uri, err := url.Parse(fmt.Sprintf("file://%s/%s", fixtureDir, test.fixture))
+		require.Nil(err)
+		rejected := counterValue(t, rejectedRecords.WithLabelValues("departures", test.reason))
+
+		var manager DataManager
+		require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options), test.fixture)
+		departures, err := manager.GetDeparturesByStops([]string{"3"})
+		require.Nil(err)
+		assert.Len(departures, 3, test.fixture)
+
+		report := manager.GetRejections()["departures"]
+		require.NotNil(report, test.fixture)
+		assert.Equal(4, report.Records, test.fixture)
+		require.Len(report.Rejected, 1, test.fixture)
+		assert.Equal(test.line, report.Rejected[0].Line, test.fixture)
+		assert.Equal(test.reason, report.Rejected[0].Reason, test.fixture)
+		assert.NotEmpty(report.Rejected[0].Message, test.fixture)
+		assert.Empty(report.Error, test.fixture)
+		assert.Equal(rejected+1, counterValue(t, rejectedRecords.WithLabelValues("departures", test.reason)))
+	}
+}
+
+func TestLenientThreshold(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var manager DataManager
+	uri, err := url.Parse(fmt.Sprintf("file://%s/first.txt", fixtureDir))
+	require.Nil(err)
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, defaultOptions))
+
+	invalid, err := url.Parse(fmt.Sprintf("file://%s/invaliddate.txt", fixtureDir))
+	require.Nil(err)
+	// 1 of the 4 records is invalid
+	options := defaultOptions
+	options.Lenient = LenientOptions{Enabled: true, MaxRejectedRatio: 0.2}
+	assert.Error(RefreshDeparturesWithOptions(&manager, *invalid, options))
+	// the previous dataset is kept
+	departures, err := manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 4)
+	report := manager.GetRejections()["departures"]
+	require.NotNil(report)
+	assert.Len(report.Rejected, 1)
+	assert.NotEmpty(report.Error)
+
+	options.Lenient = LenientOptions{Enabled: true, MaxRejected: 1}
+	require.Nil(RefreshDeparturesWithOptions(&manager, *invalid, options))
+	departures, err = manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 3)
+	assert.Empty(manager.GetRejections()["departures"].Error)
+
+	// the strict mode still rejects the whole file
+	missing, err := url.Parse(fmt.Sprintf("file://%s/missingfield.txt", fixtureDir))
+	require.Nil(err)
+	assert.Error(RefreshDeparturesWithOptions(&manager, *missing, defaultOptions))
+}
+
+func TestLenientInvalidFirstRecord(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	content := "1;87A;Mions Bourdelle\n" + strings.Repeat(oneline, 3)
+	rejections := newRejectionReport(LenientOptions{Enabled: true})
+	departures, err := loadDepartures(strings.NewReader(content), defaultOptions, rejections)
+	require.Nil(err)
+	assert.Len(departures["1"], 3)
+	assert.Equal(4, rejections.Records)
+	require.Len(rejections.Rejected, 1)
+	assert.Equal(1, rejections.Rejected[0].Line)
+	assert.Equal("missing_field", rejections.Rejected[0].Reason)
+}
+
+func TestLenientParkings(t *testing.T) {
+	require := require.New(t)
+
+	content := string(readFixture(t, "parkings.txt"))
+	// a copy of the first parking with an invalid number of available spaces
+	fields := strings.Split(strings.Split(content, "\n")[1], ";")
+	fields[0], fields[4] = "INVALID", "nope"
+	content += strings.Join(fields, ";") + "\n"
+	rejections := newRejectionReport(LenientOptions{Enabled: true})
+	parkings, err := loadParkings(strings.NewReader(content), FetchOptions{}, rejections)
+	require.Nil(err)
+	require.Len(parkings, 19)
+	// the header isn't a record
+	require.Equal(20, rejections.Records)
+	require.Len(rejections.Rejected, 1)
+	require.Equal(21, rejections.Rejected[0].Line)
+	require.Equal("invalid_number", rejections.Rejected[0].Reason)
+}
+
+func TestRejectedRecordsCap(t *testing.T) {
+	assert := assert.New(t)
+
+	// without threshold every line of a garbage file is rejected, only the first ones are kept
+	var content strings.Builder
+	for i := 0; i < MaxRejectedRecords+10; i++ {
+		content.WriteString("garbage\n")
+	}
+	rejections := newRejectionReport(LenientOptions{Enabled: true})
+	departures, err := loadDepartures(strings.NewReader(content.String()), defaultOptions, rejections)
+	require.Nil(t, err)
+	assert.Empty(departures)
+	assert.Equal(MaxRejectedRecords+10, rejections.RejectedCount)
+	assert.Len(rejections.Rejected, MaxRejectedRecords)
+
+	// the thresholds and the metric use all of them
+	reason := rejections.Rejected[0].Reason
+	previous := counterValue(t, rejectedRecords.WithLabelValues("capped", reason))
+	var manager DataManager
+	manager.reportRejections("capped", rejections)
+	assert.Equal(previous+float64(MaxRejectedRecords+10),
+		counterValue(t, rejectedRecords.WithLabelValues("capped", reason)))
+	rejections.options.MaxRejected = MaxRejectedRecords
+	assert.Error(rejections.check())
+}
+
+func TestRejectionReason(t *testing.T) {
+	_, numErr := strconv.Atoi("nope")
+	_, dateErr := time.Parse("2006-01-02", "2018-13-01")
+	tests := []struct {
+		err    error
+		reason string
+	}{
+		{&csv.ParseError{Line: 2, Err: csv.ErrFieldCount}, "field_count"},
+		{&csv.ParseError{Line: 2, Err: csv.ErrBareQuote}, "malformed"},
+		{&LineError{Line: 2, Err: &missingFieldError{"record"}}, "missing_field"},
+		{dateErr, "invalid_date"},
+		{numErr, "invalid_number"},
+		{errors.New("Unsupported EmbeddedType LIFT"), "invalid_record"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.reason, rejectionReason(test.err), test.err.Error())
+	}
+}
+
+func TestRejectionsHandler(t *testing.T) {
+	require := require.New(t)
+
+	uri, err := url.Parse(fmt.Sprintf("file://%s/invaliddate.txt", fixtureDir))
+	require.Nil(err)
+	options := defaultOptions
+	options.Lenient = LenientOptions{Enabled: true}
+
+	var manager DataManager
+	c, engine := gin.CreateTestContext(httptest.NewRecorder())
+	engine = SetupRouter(&manager, engine)
+	require.Nil(RefreshDeparturesWithOptions(&manager, *uri, options))
+
+	SetupAdminRoutes(&manager, engine, []string{"secret"})
+
+	c.Request = httptest.NewRequest("GET", "/admin/rejections", nil)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, c.Request)
+	require.Equal(http.StatusUnauthorized, w.Code)
+
+	c.Request = httptest.NewRequest("GET", "/admin/rejections", nil)
+	c.Request.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, c.Request)
+	require.Equal(200, w.Code)
+	var response RejectionsResponse
+	require.Nil(json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(response.Rejections, 1)
+	require.Len(response.Rejections["departures"].Rejected, 1)
+	require.Equal(1, response.Rejections["departures"].Rejected[0].Line)
+}
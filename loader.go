@@ -1,20 +1,20 @@
 package sytralrt
 
 import (
-	"bytes"
 	"encoding/csv"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
+	"sync"
 	"time"
 
-	"github.com/pkg/sftp"
 	"github.com/prometheus/client_golang/prometheus"
-	"golang.org/x/crypto/ssh"
-	"golang.org/x/text/encoding/charmap"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding"
 )
 
 var (
@@ -33,6 +33,13 @@ var (
 		Help:      "current number of http request being served",
 	})
 
+	departureSkippedRefreshes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sytralrt",
+		Subsystem: "departures",
+		Name:      "skipped_refreshes",
+		Help:      "number of refreshes skipped because the file hasn't changed",
+	})
+
 	parkingsLoadingDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
 		Namespace: "sytralrt",
 		Subsystem: "parkings",
@@ -48,6 +55,13 @@ var (
 		Help:      "current number of http request being served",
 	})
 
+	parkingsSkippedRefreshes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sytralrt",
+		Subsystem: "parkings",
+		Name:      "skipped_refreshes",
+		Help:      "number of refreshes skipped because the file hasn't changed",
+	})
+
 	equipmentsLoadingDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
 		Namespace: "sytralrt",
 		Subsystem: "equipments",
@@ -62,82 +76,204 @@ var (
 		Name:      "loading_errors",
 		Help:      "current number of http request being served",
 	})
+
+	equipmentsSkippedRefreshes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sytralrt",
+		Subsystem: "equipments",
+		Name:      "skipped_refreshes",
+		Help:      "number of refreshes skipped because the file hasn't changed",
+	})
 )
 
 func init() {
 	prometheus.MustRegister(departureLoadingDuration)
 	prometheus.MustRegister(departureLoadingErrors)
+	prometheus.MustRegister(departureSkippedRefreshes)
 	prometheus.MustRegister(parkingsLoadingDuration)
 	prometheus.MustRegister(parkingsLoadingErrors)
+	prometheus.MustRegister(parkingsSkippedRefreshes)
 	prometheus.MustRegister(equipmentsLoadingDuration)
 	prometheus.MustRegister(equipmentsLoadingErrors)
+	prometheus.MustRegister(equipmentsSkippedRefreshes)
 }
 
-func getFile(uri url.URL, connectionTimeout time.Duration) (io.Reader, error) {
-	if uri.Scheme == "sftp" {
-		return getFileWithSftp(uri, connectionTimeout)
-	} else if uri.Scheme == "file" {
-		return getFileWithFS(uri)
-	} else {
-		return nil, fmt.Errorf("Unsupported protocols %s", uri.Scheme)
-	}
+// FetchOptions defines how a data file is downloaded from its source
+type FetchOptions struct {
+	ConnectionTimeout time.Duration
+	HTTPHeaders       http.Header // only used by http and https sources
+	TLS               TLSOptions  // only used by https and ftps sources
+	FTP               FTPOptions  // only used by ftp and ftps sources
+	SSH               SSHOptions  // only used by sftp sources
+	S3                S3Options   // only used by s3 sources
+	Glob              GlobOptions // only used by file and sftp sources whose path is a pattern
+	// Proxy is the url of a SOCKS5 (socks5://) or HTTP CONNECT (http://) proxy used by sftp, http(s) and s3 sources
+	Proxy string
+	// Credentials are read from secret files or environment variables instead of the uri
+	Credentials CredentialsOptions
+	// MirrorRetryDelay is the time during which a failing mirror is only tried after the other ones
+	MirrorRetryDelay time.Duration
+	// MaxDecompressedSize caps the size of compressed files once decompressed, DefaultMaxDecompressedSize if 0
+	MaxDecompressedSize int64
+	// MaxSize aborts the load of the files bigger than this number of bytes, there is no limit if 0
+	MaxSize int64
+	// Archive keeps a copy of every fetched file, as it was served by its source
+	Archive ArchiveOptions
+	// Completeness defers the load of the files still being uploaded
+	Completeness CompletenessOptions
+	// Lenient skips the invalid records instead of failing the whole load
+	Lenient LenientOptions
+	// Columns replaces the default columns of some fields of the departures or parkings records
+	Columns ColumnMapping
+	// Location is the timezone of the dates of the files, DefaultTimezone if nil
+	Location *time.Location
+	// Sanity are the checks a dataset must pass to replace the current one
+	Sanity SanityOptions
+	// Charset is the encoding of the csv files, their bytes are read as UTF-8 if nil.
+	// A UTF-8 or UTF-16 byte order mark takes precedence over it.
+	Charset encoding.Encoding
+}
 
+// readCloser reads from a stream, possibly through decoders, and closes the stream itself
+type readCloser struct {
+	io.Reader
+	io.Closer
 }
 
-func getFileWithFS(uri url.URL) (io.Reader, error) {
-	file, err := os.Open(uri.Path)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-	var buffer bytes.Buffer
-	if _, err = buffer.ReadFrom(file); err != nil {
-		return nil, err
-	}
-	return &buffer, nil
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
 }
 
-func getFileWithSftp(uri url.URL, connectionTimeout time.Duration) (io.Reader, error) {
-	password, _ := uri.User.Password()
-	sshConfig := &ssh.ClientConfig{
-		User: uri.User.Username(),
-		Auth: []ssh.AuthMethod{
-			ssh.Password(password),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), //nolint:gosec
-		Timeout:         connectionTimeout,
-	}
+// fileMetadata identifies the version of a file on its source
+type fileMetadata struct {
+	uri string
+	Metadata
+	// older are the paths of the other files matching the pattern of a glob source
+	older []string
+}
+
+// sameAs returns true if both metadata describe the same version of the same file
+func (m fileMetadata) sameAs(other fileMetadata) bool {
+	return m.uri == other.uri && m.Metadata.sameAs(other.Metadata)
+}
 
-	sshClient, err := ssh.Dial("tcp", uri.Host, sshConfig)
+func getFile(uri url.URL, options FetchOptions) (io.ReadCloser, error) {
+	file, _, err := getFileIfModified(uri, options, fileMetadata{})
+	return file, err
+}
+
+// getFileIfModified opens a file, unless its source tells us it is still the one described by previous.
+// In that case ErrNotModified is returned.
+// Sources without any metadata (ftp) are always opened, s3 sources are compared by ETag.
+// If the path of a file or sftp uri is a glob pattern, the newest matching file is opened.
+// The file is streamed from its source, and decompressed on the fly if needed: it must be closed once read.
+// If an archive directory is set, the file is copied there as it is read.
+// An *incompleteFileError is returned, possibly while reading, if the file is still being uploaded.
+func getFileIfModified(uri url.URL, options FetchOptions, previous fileMetadata) (io.ReadCloser, fileMetadata, error) {
+	var older []string
+	if isGlobSource(uri) {
+		var err error
+		if uri, older, err = resolveGlob(uri, options); err != nil {
+			return nil, fileMetadata{}, err
+		}
+	}
+	if err := checkCompleteness(uri, options, previous); err != nil {
+		return nil, fileMetadata{}, err
+	}
+	file, metadata, err := getRawFileIfModified(uri, options, previous)
+	metadata.older = older
 	if err != nil {
-		return nil, err
+		return nil, metadata, err
 	}
-	defer sshClient.Close()
 
-	// open an SFTP session over an existing ssh connection.
-	client, err := sftp.NewClient(sshClient)
-	if err != nil {
-		return nil, err
+	var reader io.Reader = file
+	if options.MaxSize > 0 {
+		if metadata.Size > options.MaxSize {
+			file.Close()
+			return nil, fileMetadata{}, fmt.Errorf("size of %s exceeds %d bytes", uri.Path, options.MaxSize)
+		}
+		// the size isn't always known beforehand
+		reader = &cappedReader{reader: file, what: "size of " + uri.Path, max: options.MaxSize}
+	}
+	var closer io.Closer = file
+	if options.Archive.Dir != "" {
+		archiving, err := newArchivingReader(file, reader, uri.Path, options.Archive)
+		if err != nil {
+			logrus.Warnf("unable to archive %s: %s", uri.Path, err)
+		} else {
+			reader, closer = archiving, archiving
+		}
 	}
-	defer client.Close()
+	if reader, err = decompress(uri.Path, reader, options.MaxDecompressedSize); err != nil {
+		closer.Close()
+		return nil, fileMetadata{}, err
+	}
+	if options.Completeness.Trailer != "" {
+		if reader, err = newTrailerReader(uri.Path, reader, options.Completeness.Trailer); err != nil {
+			closer.Close()
+			return nil, fileMetadata{}, err
+		}
+	}
+	return readCloser{Reader: reader, Closer: closer}, metadata, nil
+}
 
-	file, err := client.Open(uri.Path)
+func getFileWithFS(uri url.URL, previous Metadata) (io.ReadCloser, Metadata, error) {
+	file, err := os.Open(uri.Path)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	defer file.Close()
-	var buffer bytes.Buffer
-	if _, err = file.WriteTo(&buffer); err != nil {
-		return nil, err
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, Metadata{}, err
+	}
+	metadata := Metadata{Size: info.Size(), ModTime: info.ModTime()}
+	if metadata.sameAs(previous) {
+		file.Close()
+		return nil, metadata, ErrNotModified
 	}
-	return &buffer, nil
+	return file, metadata, nil
+}
+
+// DefaultTimezone is the timezone of the dates of the files whose feed has none
+const DefaultTimezone = "Europe/Paris"
 
+var defaultLocation struct {
+	once     sync.Once
+	location *time.Location
+	err      error
+}
+
+// getLocation returns location, or the location of DefaultTimezone which is only loaded once if it is nil
+func getLocation(location *time.Location) (*time.Location, error) {
+	if location != nil {
+		return location, nil
+	}
+	defaultLocation.once.Do(func() {
+		defaultLocation.location, defaultLocation.err = time.LoadLocation(DefaultTimezone)
+	})
+	return defaultLocation.location, defaultLocation.err
 }
 
 type LoadDataOptions struct {
 	skipFirstLine bool
 	delimiter     rune
 	nbFields      int
+	location      *time.Location    // DefaultTimezone if nil
+	charset       encoding.Encoding // bytes read as UTF-8 if nil, unless the file starts with a byte order mark
+	// rejections collects the invalid records instead of failing the load, if set
+	rejections *RejectionReport
+}
+
+// LineError is returned when a line of a csv file can't be consumed
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
 }
 
 func LoadData(file io.Reader, lineConsumer LineConsumer) error {
@@ -151,31 +287,51 @@ func LoadData(file io.Reader, lineConsumer LineConsumer) error {
 
 func LoadDataWithOptions(file io.Reader, lineConsumer LineConsumer, options LoadDataOptions) error {
 
-	location, err := time.LoadLocation("Europe/Paris")
+	location, err := getLocation(options.location)
 	if err != nil {
 		return err
 	}
 
-	reader := csv.NewReader(file)
+	reader := csv.NewReader(newDecodingReader(file, options.charset))
 	reader.Comma = options.delimiter
 	reader.FieldsPerRecord = options.nbFields
+	if options.rejections != nil && options.nbFields == 0 {
+		// the number of fields of the first record isn't imposed to the next ones: all the valid records would be
+		// rejected after an invalid first one. The line consumers reject the records missing the fields they need.
+		reader.FieldsPerRecord = -1
+	}
 
 	// Loop through lines & turn into object
-	for {
+	for lineNumber := 1; ; lineNumber++ {
 		line, err := reader.Read()
 		if err == io.EOF {
 			break
+		}
+		if parseErr, ok := err.(*csv.ParseError); ok && options.rejections != nil && !options.skipFirstLine {
+			options.rejections.Records++
+			options.rejections.reject(parseErr.Line, "", parseErr)
+			continue
 		} else if err != nil {
 			return err
 		}
 
 		if options.skipFirstLine {
 			options.skipFirstLine = false
+			if headerConsumer, ok := lineConsumer.(HeaderConsumer); ok {
+				if err := headerConsumer.ConsumeHeader(line); err != nil {
+					return &LineError{Line: lineNumber, Err: err}
+				}
+			}
 			continue
 		}
 
-		if err := lineConsumer.Consume(line, location); err != nil {
-			return err
+		if options.rejections != nil {
+			options.rejections.Records++
+		}
+		if err := lineConsumer.Consume(line, location); err != nil && options.rejections != nil {
+			options.rejections.reject(lineNumber, "", err)
+		} else if err != nil {
+			return &LineError{Line: lineNumber, Err: err}
 		}
 	}
 
@@ -202,37 +358,55 @@ func CalculateDate(info Info, location *time.Location) (time.Time, error) {
 }
 
 func LoadXmlData(file io.Reader) ([]EquipmentDetail, error) {
+	return loadEquipments(file, FetchOptions{}, nil)
+}
 
-	location, err := time.LoadLocation("Europe/Paris")
+// loadEquipments parses an equipments file, its invalid equipments are skipped if rejections is set
+func loadEquipments(file io.Reader, options FetchOptions, rejections *RejectionReport) ([]EquipmentDetail, error) {
+	location, err := getLocation(options.Location)
 	if err != nil {
 		return nil, err
 	}
 
-	XMLdata, err := ioutil.ReadAll(file)
-	if err != nil {
-		return nil, err
-	}
-	decoder := xml.NewDecoder(bytes.NewReader(XMLdata))
+	input, bom := skipBOM(file)
+	decoder := xml.NewDecoder(input)
 	decoder.CharsetReader = getCharsetReader
+	if bom {
+		// the byte order mark prevails over the declared encoding, the file is already decoded
+		decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+	}
 
 	var root Root
 	err = decoder.Decode(&root)
 	if err != nil {
 		return nil, err
 	}
+	// the decoder stops at the end of the root element, the trailer of the file is only checked at its end
+	if _, err := io.Copy(ioutil.Discard, input); err != nil {
+		return nil, err
+	}
+	if err := root.validate(); err != nil {
+		return nil, err
+	}
 
 	equipments := make(map[string]EquipmentDetail)
 	//Calculate updated_at from Info.Date and Info.Hour
 	updatedAt, err := CalculateDate(root.Info, location)
 	if err != nil {
-		return nil, err
+		return nil, &XMLPathError{Path: "/root/infos_generales", Err: err}
 	}
 	// for each root.Data.Lines.Stations create an object Equipment
-	for _, l := range root.Data.Lines {
-		for _, s := range l.Stations {
-			for _, e := range s.Equipments {
-				ed, err := NewEquipmentDetail(e, updatedAt, location)
-				if err != nil {
+	for i, l := range root.Data.Lines {
+		for j, s := range l.Stations {
+			for k, e := range s.Equipments {
+				if rejections != nil {
+					rejections.Records++
+				}
+				ed, err := readEquipment(equipmentPath(i, j, k), e, updatedAt, location)
+				if err != nil && rejections != nil {
+					rejections.reject(0, e.ID, err)
+					continue
+				} else if err != nil {
 					return nil, err
 				}
 				equipments[ed.ID] = *ed
@@ -240,6 +414,10 @@ func LoadXmlData(file io.Reader) ([]EquipmentDetail, error) {
 		}
 	}
 
+	if err := rejections.check(); err != nil {
+		return nil, err
+	}
+
 	// Transform the map to array of EquipmentDetail
 	equipmentDetails := make([]EquipmentDetail, 0)
 	for _, ed := range equipments {
@@ -250,71 +428,185 @@ func LoadXmlData(file io.Reader) ([]EquipmentDetail, error) {
 }
 
 func RefreshDepartures(manager *DataManager, uri url.URL, connectionTimeout time.Duration) error {
+	return RefreshDeparturesWithOptions(manager, uri, FetchOptions{ConnectionTimeout: connectionTimeout})
+}
+
+func RefreshDeparturesWithOptions(manager *DataManager, uri url.URL, options FetchOptions) error {
+	return RefreshDeparturesFromMirrors(manager, []url.URL{uri}, options)
+}
+
+// RefreshDeparturesFromMirrors loads the departures from the first of uris able to serve them
+func RefreshDeparturesFromMirrors(manager *DataManager, uris []url.URL, options FetchOptions) error {
 	begin := time.Now()
-	file, err := getFile(uri, connectionTimeout)
-	if err != nil {
+	manager.setMirrors("departures", uris)
+	manager.setArchiveDir("departures", options.Archive.Dir)
+	file, metadata, err := getFileFromMirrors("departures", uris, options, manager.getDeparturesFile())
+	if err == ErrNotModified {
+		manager.setDeparturesChecked()
+		departureSkippedRefreshes.Inc()
+		return nil
+	} else if deferIfIncomplete("departures", err) {
+		return nil
+	} else if err != nil {
 		departureLoadingErrors.Inc()
 		return err
 	}
+	defer file.Close()
 
-	departureConsumer := makeDepartureLineConsumer()
-	if err = LoadData(file, departureConsumer); err != nil {
+	rejections := newRejectionReport(options.Lenient)
+	departures, err := loadDepartures(file, options, rejections)
+	if deferIfIncomplete("departures", err) {
+		return nil
+	}
+	manager.reportRejections("departures", rejections)
+	if err != nil {
 		departureLoadingErrors.Inc()
 		return err
 	}
-	manager.UpdateDepartures(departureConsumer.data)
+	if err = manager.checkDepartures(departures, metadata, options.Sanity); err != nil {
+		return err
+	}
+	manager.updateDepartures(departures, metadata)
+	moveProcessedFiles(metadata, options)
 	departureLoadingDuration.Observe(time.Since(begin).Seconds())
 	return nil
 }
 
+// loadDepartures parses a departures file with the columns and timezone of options.
+// Its invalid records are skipped if rejections is set.
+func loadDepartures(file io.Reader, options FetchOptions,
+	rejections *RejectionReport) (map[string][]Departure, error) {
+	departureConsumer, err := newDepartureLineConsumer(options.Columns)
+	if err != nil {
+		return nil, err
+	}
+	loadDataOptions := LoadDataOptions{
+		delimiter:  ';',
+		nbFields:   0, // do not check record size in csv.reader
+		location:   options.Location,
+		charset:    options.Charset,
+		rejections: rejections,
+	}
+	if err := LoadDataWithOptions(file, departureConsumer, loadDataOptions); err != nil {
+		return nil, err
+	}
+	if err := rejections.check(); err != nil {
+		return nil, err
+	}
+	return departureConsumer.data, nil
+}
+
 func RefreshParkings(manager *DataManager, uri url.URL, connectionTimeout time.Duration) error {
+	return RefreshParkingsWithOptions(manager, uri, FetchOptions{ConnectionTimeout: connectionTimeout})
+}
+
+func RefreshParkingsWithOptions(manager *DataManager, uri url.URL, options FetchOptions) error {
+	return RefreshParkingsFromMirrors(manager, []url.URL{uri}, options)
+}
+
+// RefreshParkingsFromMirrors loads the parkings from the first of uris able to serve them
+func RefreshParkingsFromMirrors(manager *DataManager, uris []url.URL, options FetchOptions) error {
 	begin := time.Now()
-	file, err := getFile(uri, connectionTimeout)
-	if err != nil {
+	manager.setMirrors("parkings", uris)
+	manager.setArchiveDir("parkings", options.Archive.Dir)
+	file, metadata, err := getFileFromMirrors("parkings", uris, options, manager.getParkingsFile())
+	if err == ErrNotModified {
+		manager.setParkingsChecked()
+		parkingsSkippedRefreshes.Inc()
+		return nil
+	} else if deferIfIncomplete("parkings", err) {
+		return nil
+	} else if err != nil {
 		parkingsLoadingErrors.Inc()
 		return err
 	}
+	defer file.Close()
 
-	parkingsConsumer := makeParkingLineConsumer()
-	loadDataOptions := LoadDataOptions{
-		delimiter:     ';',
-		nbFields:      0,    // We might not have etereogenous lines
-		skipFirstLine: true, // First line is a header
+	rejections := newRejectionReport(options.Lenient)
+	parkings, err := loadParkings(file, options, rejections)
+	if deferIfIncomplete("parkings", err) {
+		return nil
 	}
-	err = LoadDataWithOptions(file, parkingsConsumer, loadDataOptions)
+	manager.reportRejections("parkings", rejections)
 	if err != nil {
 		parkingsLoadingErrors.Inc()
 		return err
 	}
-
-	manager.UpdateParkings(parkingsConsumer.parkings)
+	if err = manager.checkParkings(parkings, options.Sanity); err != nil {
+		return err
+	}
+	manager.updateParkings(parkings, metadata)
+	moveProcessedFiles(metadata, options)
 	parkingsLoadingDuration.Observe(time.Since(begin).Seconds())
 
 	return nil
 }
 
-func getCharsetReader(charset string, input io.Reader) (io.Reader, error) {
-	if charset == "ISO-8859-1" {
-		return charmap.ISO8859_1.NewDecoder().Reader(input), nil
+// loadParkings parses a parkings file with the columns and timezone of options.
+// Its invalid records are skipped if rejections is set.
+func loadParkings(file io.Reader, options FetchOptions, rejections *RejectionReport) (map[string]Parking, error) {
+	parkingsConsumer, err := newParkingLineConsumer(options.Columns)
+	if err != nil {
+		return nil, err
 	}
-
-	return nil, fmt.Errorf("Unknown Charset")
+	loadDataOptions := LoadDataOptions{
+		delimiter:     ';',
+		nbFields:      0,    // We might not have etereogenous lines
+		skipFirstLine: true, // First line is a header
+		location:      options.Location,
+		charset:       options.Charset,
+		rejections:    rejections,
+	}
+	if err := LoadDataWithOptions(file, parkingsConsumer, loadDataOptions); err != nil {
+		return nil, err
+	}
+	if err := rejections.check(); err != nil {
+		return nil, err
+	}
+	return parkingsConsumer.parkings, nil
 }
 
 func RefreshEquipments(manager *DataManager, uri url.URL, connectionTimeout time.Duration) error {
+	return RefreshEquipmentsWithOptions(manager, uri, FetchOptions{ConnectionTimeout: connectionTimeout})
+}
+
+func RefreshEquipmentsWithOptions(manager *DataManager, uri url.URL, options FetchOptions) error {
+	return RefreshEquipmentsFromMirrors(manager, []url.URL{uri}, options)
+}
+
+// RefreshEquipmentsFromMirrors loads the equipments from the first of uris able to serve them
+func RefreshEquipmentsFromMirrors(manager *DataManager, uris []url.URL, options FetchOptions) error {
 	begin := time.Now()
-	file, err := getFile(uri, connectionTimeout)
-	if err != nil {
+	manager.setMirrors("equipments", uris)
+	manager.setArchiveDir("equipments", options.Archive.Dir)
+	file, metadata, err := getFileFromMirrors("equipments", uris, options, manager.getEquipmentsFile())
+	if err == ErrNotModified {
+		manager.setEquipmentsChecked()
+		equipmentsSkippedRefreshes.Inc()
+		return nil
+	} else if deferIfIncomplete("equipments", err) {
+		return nil
+	} else if err != nil {
 		equipmentsLoadingErrors.Inc()
 		return err
 	}
+	defer file.Close()
 
-	equipments, err := LoadXmlData(file)
+	rejections := newRejectionReport(options.Lenient)
+	equipments, err := loadEquipments(file, options, rejections)
+	if deferIfIncomplete("equipments", err) {
+		return nil
+	}
+	manager.reportRejections("equipments", rejections)
 	if err != nil {
 		equipmentsLoadingErrors.Inc()
 		return err
 	}
-	manager.UpdateEquipments(equipments)
+	if err = manager.checkEquipments(equipments, options.Sanity); err != nil {
+		return err
+	}
+	manager.updateEquipments(equipments, metadata)
+	moveProcessedFiles(metadata, options)
 	equipmentsLoadingDuration.Observe(time.Since(begin).Seconds())
 	return nil
 }
@@ -0,0 +1,138 @@
+package sytralrt
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MirrorStatus is the health of a mirror of a feed as exposed by /status
+type MirrorStatus struct {
+	URI                 string     `json:"uri"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+}
+
+type mirrorHealth struct {
+	failures    int
+	lastError   string
+	lastSuccess time.Time
+	lastFailure time.Time
+}
+
+// mirrorRegistry tracks the health of every uri a feed has been fetched from
+type mirrorRegistry struct {
+	mutex  sync.Mutex
+	health map[string]*mirrorHealth
+	now    func() time.Time
+}
+
+var mirrors = &mirrorRegistry{health: make(map[string]*mirrorHealth), now: time.Now}
+
+func (r *mirrorRegistry) get(uri url.URL) *mirrorHealth {
+	health, ok := r.health[uri.String()]
+	if !ok {
+		health = &mirrorHealth{}
+		r.health[uri.String()] = health
+	}
+	return health
+}
+
+// order returns the mirrors in the order they should be tried:
+// the ones that failed less than retryDelay ago are moved to the end, the others keep their configured order
+func (r *mirrorRegistry) order(uris []url.URL, retryDelay time.Duration) []url.URL {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	ordered := make([]url.URL, 0, len(uris))
+	var failing []url.URL
+	for _, uri := range uris {
+		health := r.get(uri)
+		if health.failures > 0 && r.now().Sub(health.lastFailure) < retryDelay {
+			failing = append(failing, uri)
+		} else {
+			ordered = append(ordered, uri)
+		}
+	}
+	return append(ordered, failing...)
+}
+
+func (r *mirrorRegistry) success(uri url.URL) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	health := r.get(uri)
+	health.failures = 0
+	health.lastError = ""
+	health.lastSuccess = r.now()
+}
+
+func (r *mirrorRegistry) failure(uri url.URL, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	health := r.get(uri)
+	health.failures++
+	health.lastError = err.Error()
+	health.lastFailure = r.now()
+}
+
+func (r *mirrorRegistry) status(uri url.URL) MirrorStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	health := r.get(uri)
+	status := MirrorStatus{
+		URI:                 RedactURI(uri),
+		ConsecutiveFailures: health.failures,
+		LastError:           health.lastError,
+	}
+	if !health.lastSuccess.IsZero() {
+		lastSuccess := health.lastSuccess
+		status.LastSuccess = &lastSuccess
+	}
+	if !health.lastFailure.IsZero() {
+		lastFailure := health.lastFailure
+		status.LastFailure = &lastFailure
+	}
+	return status
+}
+
+// getFileFromMirrors fetches a file from the first mirror able to serve it
+func getFileFromMirrors(feed string, uris []url.URL, options FetchOptions,
+	previous fileMetadata) (io.ReadCloser, fileMetadata, error) {
+	if len(uris) == 0 {
+		return nil, fileMetadata{}, fmt.Errorf("no uri configured for %s", feed)
+	}
+
+	var errs []string
+	var lastErr error
+	for _, uri := range mirrors.order(uris, options.MirrorRetryDelay) {
+		file, metadata, err := getFileIfModified(uri, options, previous)
+		if _, ok := err.(*incompleteFileError); ok {
+			// the mirror works, the file will be loaded once complete
+			mirrors.success(uri)
+			return nil, fileMetadata{}, err
+		}
+		if err == nil || err == ErrNotModified {
+			mirrors.success(uri)
+			if len(uris) > 1 && metadata.uri != previous.uri {
+				logrus.Infof("%s data served by %s", feed, RedactURI(uri))
+			}
+			return file, metadata, err
+		}
+		mirrors.failure(uri, err)
+		lastErr = err
+		errs = append(errs, fmt.Sprintf("%s: %s", RedactURI(uri), err))
+		if len(uris) > 1 {
+			logrus.Warnf("unable to fetch %s data from %s: %s", feed, RedactURI(uri), err)
+		}
+	}
+	if len(errs) == 1 {
+		return nil, fileMetadata{}, lastErr
+	}
+	return nil, fileMetadata{}, fmt.Errorf("all the mirrors failed: %s", strings.Join(errs, "; "))
+}
@@ -0,0 +1,94 @@
+package sytralrt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshFromMirrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "sytralrt-mirrors")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+	primary, err := url.Parse(fmt.Sprintf("file://%s/extract_edylic.txt", dir))
+	require.Nil(err)
+	backup, err := url.Parse(fmt.Sprintf("file://%s/first.txt", fixtureDir))
+	require.Nil(err)
+	uris := []url.URL{*primary, *backup}
+	options := defaultOptions
+	options.MirrorRetryDelay = time.Hour
+
+	// the primary doesn't exist yet, the data comes from the backup
+	var manager DataManager
+	require.Nil(RefreshDeparturesFromMirrors(&manager, uris, options))
+	departures, err := manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 4)
+
+	status := manager.GetFeedsStatus()["departures"]
+	assert.Equal(backup.String(), status.Source)
+	require.Len(status.Mirrors, 2)
+	assert.Equal(primary.String(), status.Mirrors[0].URI)
+	assert.Equal(1, status.Mirrors[0].ConsecutiveFailures)
+	assert.NotEmpty(status.Mirrors[0].LastError)
+	assert.Nil(status.Mirrors[0].LastSuccess)
+	assert.Equal(0, status.Mirrors[1].ConsecutiveFailures)
+	assert.NotNil(status.Mirrors[1].LastSuccess)
+
+	// the failing primary isn't tried first until its retry delay is elapsed
+	copyFixture(t, "second.txt", filepath.Join(dir, "extract_edylic.txt"), time.Now())
+	require.Nil(RefreshDeparturesFromMirrors(&manager, uris, options))
+	assert.Equal(backup.String(), manager.GetFeedsStatus()["departures"].Source)
+
+	options.MirrorRetryDelay = 0
+	require.Nil(RefreshDeparturesFromMirrors(&manager, uris, options))
+	status = manager.GetFeedsStatus()["departures"]
+	assert.Equal(primary.String(), status.Source)
+	assert.Equal(0, status.Mirrors[0].ConsecutiveFailures)
+	departures, err = manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 3)
+
+	// when every mirror fails the dataset is kept
+	require.Nil(os.Remove(filepath.Join(dir, "extract_edylic.txt")))
+	missing, err := url.Parse(fmt.Sprintf("file://%s/missing.txt", dir))
+	require.Nil(err)
+	err = RefreshDeparturesFromMirrors(&manager, []url.URL{*primary, *missing}, options)
+	require.Error(err)
+	assert.Contains(err.Error(), "all the mirrors failed")
+	assert.Equal(primary.String(), manager.GetFeedsStatus()["departures"].Source)
+	departures, err = manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 3)
+
+	require.Error(RefreshDeparturesFromMirrors(&manager, nil, options))
+}
+
+func TestMirrorsOrder(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	registry := &mirrorRegistry{health: make(map[string]*mirrorHealth), now: func() time.Time { return now }}
+	var uris []url.URL
+	for _, host := range []string{"a", "b", "c"} {
+		uris = append(uris, url.URL{Scheme: "sftp", Host: host, Path: "/extract.txt"})
+	}
+
+	assert.Equal(t, uris, registry.order(uris, time.Minute))
+	registry.failure(uris[0], fmt.Errorf("connection refused"))
+	registry.failure(uris[1], fmt.Errorf("connection refused"))
+	assert.Equal(t, []url.URL{uris[2], uris[0], uris[1]}, registry.order(uris, time.Minute))
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, uris, registry.order(uris, time.Minute))
+	registry.success(uris[0])
+	assert.Equal(t, []url.URL{uris[0], uris[2], uris[1]}, registry.order(uris, time.Hour))
+}
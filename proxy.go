@@ -0,0 +1,96 @@
+package sytralrt
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// newDialer returns the dialer opening the connections to the sources,
+// through the SOCKS5 (socks5://) or HTTP CONNECT (http://) proxy of proxyURL if it isn't empty
+func newDialer(proxyURL string, timeout time.Duration) (proxy.Dialer, error) {
+	direct := &net.Dialer{Timeout: timeout}
+	if proxyURL == "" {
+		return direct, nil
+	}
+	uri, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, errInvalidURL("proxy")
+	}
+	switch uri.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if uri.User != nil {
+			password, _ := uri.User.Password()
+			auth = &proxy.Auth{User: uri.User.Username(), Password: password}
+		}
+		return proxy.SOCKS5("tcp", uri.Host, auth, direct)
+	case "http":
+		return &httpConnectDialer{proxy: *uri, forward: direct, timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %s, expected socks5 or http", uri.Scheme)
+	}
+}
+
+// httpConnectDialer opens tunnels with the CONNECT method of an http proxy
+type httpConnectDialer struct {
+	proxy   url.URL
+	forward proxy.Dialer
+	timeout time.Duration // of the CONNECT handshake, none if 0
+}
+
+func (d *httpConnectDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := d.forward.Dial(network, d.proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.proxy.User != nil {
+		password, _ := d.proxy.User.Password()
+		request.SetBasicAuth(d.proxy.User.Username(), password)
+		request.Header["Proxy-Authorization"] = request.Header["Authorization"]
+		delete(request.Header, "Authorization")
+	}
+	// a proxy accepting the connection but never answering must not block the refresh
+	if d.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.timeout)) //nolint:errcheck
+	}
+	if err = request.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused to connect to %s: %s", d.proxy.Host, addr, response.Status)
+	}
+	conn.SetDeadline(time.Time{}) //nolint:errcheck
+	// the server may already have sent data, like the banner of a ssh server
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn is a connection whose first bytes have already been buffered
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
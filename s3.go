@@ -0,0 +1,202 @@
+package sytralrt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Options defines how objects are fetched from an S3 compatible object storage
+type S3Options struct {
+	// Endpoint is the url of the object storage, https://s3.<region>.amazonaws.com if empty
+	Endpoint string
+	// Region is used to sign the requests, $AWS_REGION or us-east-1 if empty
+	Region string
+	// PathStyle puts the bucket in the path of the url instead of its host, as most S3 compatible storages expect
+	PathStyle bool
+	// AccessKeyID and SecretAccessKey are used if the uri has no credentials,
+	// $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN if they are empty too.
+	// Requests are anonymous without any credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// the hash of an empty payload, signed for the GET requests
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func s3CredentialsOf(uri url.URL, options S3Options) s3Credentials {
+	if uri.User != nil {
+		secret, _ := uri.User.Password()
+		return s3Credentials{accessKeyID: uri.User.Username(), secretAccessKey: secret}
+	}
+	if options.AccessKeyID != "" {
+		return s3Credentials{accessKeyID: options.AccessKeyID, secretAccessKey: options.SecretAccessKey}
+	}
+	return s3Credentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+func s3Region(options S3Options) string {
+	for _, region := range []string{options.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")} {
+		if region != "" {
+			return region
+		}
+	}
+	return "us-east-1"
+}
+
+// s3ObjectURL returns the url of the object of a s3://bucket/key uri
+func s3ObjectURL(uri url.URL, options S3Options, region string) (*url.URL, error) {
+	bucket, key := uri.Host, strings.TrimPrefix(uri.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("invalid s3 uri %s, expected s3://bucket/key", RedactURI(uri))
+	}
+	endpoint := options.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	object, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errInvalidURL("s3 endpoint")
+	}
+	if options.PathStyle {
+		object.Path = strings.TrimSuffix(object.Path, "/") + "/" + bucket + "/" + key
+	} else {
+		object.Host = bucket + "." + object.Host
+		object.Path = strings.TrimSuffix(object.Path, "/") + "/" + key
+	}
+	// the path is signed as it is sent
+	object.RawPath = awsEscape(object.Path, false)
+	return object, nil
+}
+
+func getFileWithS3(uri url.URL, options FetchOptions, previous Metadata) (io.ReadCloser, Metadata, error) {
+	uri, err := withCredentials(uri, options.Credentials)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	region := s3Region(options.S3)
+	object, err := s3ObjectURL(uri, options.S3, region)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	request, err := http.NewRequest(http.MethodGet, object.String(), nil)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	if credentials := s3CredentialsOf(uri, options.S3); credentials.accessKeyID != "" {
+		request.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+		signV4(request, credentials, region, "s3", time.Now())
+	}
+	// S3 answers If-None-Match with the ETag of the object, which changes with its content
+	return getConditionally(request, options, previous)
+}
+
+// signV4 signs a request without body with the AWS signature version 4, all the headers already set are signed
+func signV4(request *http.Request, credentials s3Credentials, region, service string, now time.Time) {
+	timestamp := now.UTC().Format("20060102T150405Z")
+	request.Header.Set("X-Amz-Date", timestamp)
+	if credentials.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", credentials.sessionToken)
+	}
+	payloadHash := request.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = emptyPayloadHash
+	}
+
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range request.Header {
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := request.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parameters []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parameters = append(parameters, awsEscape(key, true)+"="+awsEscape(value, true))
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		strings.Join(parameters, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{timestamp[:8], region, service, "aws4_request"}, "/")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", timestamp, scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := []byte("AWS4" + credentials.secretAccessKey)
+	for _, part := range []string{timestamp[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data)) //nolint:errcheck
+	return mac.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but the unreserved characters, and the slashes unless escapeSlash is set
+func awsEscape(s string, escapeSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !escapeSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
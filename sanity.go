@@ -0,0 +1,177 @@
+package sytralrt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var sanityRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sytralrt",
+	Name:      "sanity_rejections",
+	Help:      "number of datasets rejected by a sanity check, the previous one being kept",
+}, []string{"feed", "check"})
+
+func init() {
+	prometheus.MustRegister(sanityRejections)
+}
+
+// SanityOptions are the checks a new dataset must pass to replace the one currently served,
+// which is kept if one of them fails
+type SanityOptions struct {
+	// MinRecords is the minimum number of records of a dataset, there is no minimum if 0
+	MinRecords int
+	// MaxDropRatio is the biggest part of the records of the current dataset a new one may lose,
+	// like 0.5, there is no limit if 0
+	MaxDropRatio float64
+	// RejectFutureTimestamps rejects the datasets having a timestamp later than now plus ClockSkew:
+	// the counts of the parkings and the update of the equipments have to be in the past
+	RejectFutureTimestamps bool
+	ClockSkew              time.Duration
+	// RejectBackwards rejects the datasets older than the current one, according to their latest timestamp,
+	// or to the modification time of their file for the departures. It is skipped if either time is unknown,
+	// like for the files pushed to /ingest or served without modification time.
+	RejectBackwards bool
+}
+
+// SanityRejection is a dataset rejected by a sanity check
+type SanityRejection struct {
+	Check      string    `json:"check"`
+	Reason     string    `json:"reason"`
+	RejectedAt time.Time `json:"rejected_at"`
+}
+
+// SanityError is returned by the refreshes and the ingestions whose dataset failed a sanity check
+type SanityError struct {
+	Feed string
+	SanityRejection
+}
+
+func (e *SanityError) Error() string {
+	return fmt.Sprintf("%s dataset rejected by the %s check: %s", e.Feed, e.Check, e.Reason)
+}
+
+// datasetSummary is what the sanity checks look at in a dataset
+type datasetSummary struct {
+	records int
+	// timestamps are the dates of the dataset that can't be in the future
+	timestamps []time.Time
+	// feedTime is when the dataset has been produced, zero if unknown
+	feedTime time.Time
+}
+
+func summarizeDepartures(departures map[string][]Departure, file fileMetadata) datasetSummary {
+	summary := datasetSummary{feedTime: file.ModTime}
+	for _, stopDepartures := range departures {
+		summary.records += len(stopDepartures)
+	}
+	return summary
+}
+
+func summarizeParkings(parkings map[string]Parking) datasetSummary {
+	summary := datasetSummary{records: len(parkings)}
+	for _, p := range parkings {
+		summary.add(p.UpdatedTime)
+	}
+	return summary
+}
+
+func summarizeEquipments(equipments []EquipmentDetail) datasetSummary {
+	summary := datasetSummary{records: len(equipments)}
+	for _, e := range equipments {
+		summary.add(e.CurrentAvailability.UpdatedAt)
+	}
+	return summary
+}
+
+// add adds a timestamp to the summary, the latest one being the time of the feed
+func (s *datasetSummary) add(timestamp time.Time) {
+	s.timestamps = append(s.timestamps, timestamp)
+	if timestamp.After(s.feedTime) {
+		s.feedTime = timestamp
+	}
+}
+
+// check returns the first check failed by candidate, nil if it can replace current, which is nil if there is none
+func (o SanityOptions) check(current *datasetSummary, candidate datasetSummary, now time.Time) *SanityRejection {
+	reject := func(check, format string, args ...interface{}) *SanityRejection {
+		return &SanityRejection{Check: check, Reason: fmt.Sprintf(format, args...), RejectedAt: now}
+	}
+	if candidate.records < o.MinRecords {
+		return reject("min_records", "%d records, at least %d expected", candidate.records, o.MinRecords)
+	}
+	if o.MaxDropRatio > 0 && current != nil && current.records > 0 {
+		drop := float64(current.records-candidate.records) / float64(current.records)
+		if drop > o.MaxDropRatio {
+			return reject("max_drop", "%d records instead of %d, a drop of %.0f%% above the %.0f%% allowed",
+				candidate.records, current.records, drop*100, o.MaxDropRatio*100)
+		}
+	}
+	if o.RejectFutureTimestamps {
+		for _, timestamp := range candidate.timestamps {
+			if timestamp.After(now.Add(o.ClockSkew)) {
+				return reject("future_timestamp", "timestamp %s is in the future", timestamp.Format(time.RFC3339))
+			}
+		}
+	}
+	if o.RejectBackwards && current != nil && !current.feedTime.IsZero() && !candidate.feedTime.IsZero() &&
+		candidate.feedTime.Before(current.feedTime) {
+		return reject("backwards", "dataset of %s older than the current one of %s",
+			candidate.feedTime.Format(time.RFC3339), current.feedTime.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkSanity checks that a dataset can replace the current one of a feed, whose summary is nil if it has none.
+// The failure is counted and kept for /status, it is cleared once a dataset passes the checks.
+func (d *DataManager) checkSanity(feed string, options SanityOptions, current *datasetSummary,
+	candidate datasetSummary) error {
+	rejection := options.check(current, candidate, time.Now())
+
+	d.feedsMutex.Lock()
+	d.feed(feed).sanity = rejection
+	d.feedsMutex.Unlock()
+
+	if rejection == nil {
+		return nil
+	}
+	sanityRejections.WithLabelValues(feed, rejection.Check).Inc()
+	logrus.Warnf("%s dataset rejected, the previous one is kept: %s", feed, rejection.Reason)
+	return &SanityError{Feed: feed, SanityRejection: *rejection}
+}
+
+func (d *DataManager) checkDepartures(departures map[string][]Departure, file fileMetadata,
+	options SanityOptions) error {
+	d.departuresMutex.RLock()
+	var current *datasetSummary
+	if d.departures != nil {
+		summary := summarizeDepartures(*d.departures, d.departuresFile)
+		current = &summary
+	}
+	d.departuresMutex.RUnlock()
+	return d.checkSanity("departures", options, current, summarizeDepartures(departures, file))
+}
+
+func (d *DataManager) checkParkings(parkings map[string]Parking, options SanityOptions) error {
+	d.parkingsMutex.RLock()
+	var current *datasetSummary
+	if d.parkings != nil {
+		summary := summarizeParkings(*d.parkings)
+		current = &summary
+	}
+	d.parkingsMutex.RUnlock()
+	return d.checkSanity("parkings", options, current, summarizeParkings(parkings))
+}
+
+func (d *DataManager) checkEquipments(equipments []EquipmentDetail, options SanityOptions) error {
+	d.equipmentsMutex.RLock()
+	var current *datasetSummary
+	if d.equipments != nil {
+		summary := summarizeEquipments(*d.equipments)
+		current = &summary
+	}
+	d.equipmentsMutex.RUnlock()
+	return d.checkSanity("equipments", options, current, summarizeEquipments(equipments))
+}
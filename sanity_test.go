@@ -0,0 +1,150 @@
+package sytralrt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanityCheck(t *testing.T) {
+	now := time.Date(2018, 9, 17, 20, 0, 0, 0, time.UTC)
+	current := &datasetSummary{records: 10, feedTime: now.Add(-time.Hour)}
+	tests := []struct {
+		name      string
+		options   SanityOptions
+		current   *datasetSummary
+		candidate datasetSummary
+		check     string
+	}{
+		{"no checks", SanityOptions{}, current, datasetSummary{}, ""},
+		{"min records", SanityOptions{MinRecords: 5}, nil, datasetSummary{records: 4}, "min_records"},
+		{"enough records", SanityOptions{MinRecords: 5}, nil, datasetSummary{records: 5}, ""},
+		{"drop", SanityOptions{MaxDropRatio: 0.5}, current, datasetSummary{records: 4}, "max_drop"},
+		{"small drop", SanityOptions{MaxDropRatio: 0.5}, current, datasetSummary{records: 5}, ""},
+		{"drop without current dataset", SanityOptions{MaxDropRatio: 0.5}, nil, datasetSummary{records: 1}, ""},
+		{
+			"future", SanityOptions{RejectFutureTimestamps: true, ClockSkew: time.Minute}, nil,
+			datasetSummary{timestamps: []time.Time{now.Add(-time.Hour), now.Add(2 * time.Minute)}}, "future_timestamp",
+		},
+		{
+			"within clock skew", SanityOptions{RejectFutureTimestamps: true, ClockSkew: time.Minute}, nil,
+			datasetSummary{timestamps: []time.Time{now.Add(30 * time.Second)}}, "",
+		},
+		{
+			"backwards", SanityOptions{RejectBackwards: true}, current,
+			datasetSummary{feedTime: now.Add(-2 * time.Hour)}, "backwards",
+		},
+		{"same time", SanityOptions{RejectBackwards: true}, current, datasetSummary{feedTime: current.feedTime}, ""},
+		// a mirror or a pushed file may not give the modification time of the departures
+		{"unknown time", SanityOptions{RejectBackwards: true}, current, datasetSummary{}, ""},
+		{"unknown current time", SanityOptions{RejectBackwards: true}, &datasetSummary{records: 10},
+			datasetSummary{feedTime: now}, ""},
+	}
+	for _, test := range tests {
+		rejection := test.options.check(test.current, test.candidate, now)
+		if test.check == "" {
+			assert.Nil(t, rejection, test.name)
+			continue
+		}
+		require.NotNil(t, rejection, test.name)
+		assert.Equal(t, test.check, rejection.Check, test.name)
+		assert.Equal(t, now, rejection.RejectedAt, test.name)
+		assert.NotEmpty(t, rejection.Reason, test.name)
+	}
+}
+
+func TestSummarizeParkings(t *testing.T) {
+	first := time.Date(2018, 9, 17, 19, 29, 0, 0, time.UTC)
+	summary := summarizeParkings(map[string]Parking{
+		"DECC": {ID: "DECC", UpdatedTime: first},
+		"VAI1": {ID: "VAI1", UpdatedTime: first.Add(time.Minute)},
+	})
+	assert.Equal(t, 2, summary.records)
+	assert.Len(t, summary.timestamps, 2)
+	assert.Equal(t, first.Add(time.Minute), summary.feedTime)
+}
+
+func TestSanityKeepsPreviousDataset(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var manager DataManager
+	c, engine := gin.CreateTestContext(httptest.NewRecorder())
+	engine = SetupRouter(&manager, engine)
+	status := func() FeedStatus {
+		c.Request = httptest.NewRequest("GET", "/status", nil)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, c.Request)
+		require.Equal(200, w.Code)
+		var response StatusResponse
+		require.Nil(json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Feeds["departures"]
+	}
+
+	first, err := url.Parse(fmt.Sprintf("file://%s/first.txt", fixtureDir))
+	require.Nil(err)
+	second, err := url.Parse(fmt.Sprintf("file://%s/second.txt", fixtureDir))
+	require.Nil(err)
+	options := defaultOptions
+	options.Sanity = SanityOptions{MinRecords: 4}
+	require.Nil(RefreshDeparturesWithOptions(&manager, *first, options))
+	assert.Nil(status().SanityRejection)
+
+	rejections := counterValue(t, sanityRejections.WithLabelValues("departures", "min_records"))
+	err = RefreshDeparturesWithOptions(&manager, *second, options)
+	require.IsType(&SanityError{}, err)
+	assert.Equal("min_records", err.(*SanityError).Check)
+	assert.Equal(rejections+1, counterValue(t, sanityRejections.WithLabelValues("departures", "min_records")))
+
+	// the previous dataset is kept and the rejection is shown by /status
+	departures, err := manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 4)
+	rejection := status().SanityRejection
+	require.NotNil(rejection)
+	assert.Equal("min_records", rejection.Check)
+	assert.Equal("3 records, at least 4 expected", rejection.Reason)
+
+	// the rejection is cleared once a dataset passes the checks
+	options.Sanity = SanityOptions{MaxDropRatio: 0.5}
+	require.Nil(RefreshDeparturesWithOptions(&manager, *second, options))
+	departures, err = manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 3)
+	assert.Nil(status().SanityRejection)
+}
+
+func TestSanityOfPushedFiles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var manager DataManager
+	engine := SetupRouter(&manager, gin.New())
+	SetupIngestRoutes(&manager, engine, IngestOptions{Tokens: []string{"secret"}, Feeds: map[string]FetchOptions{
+		"departures": {Sanity: SanityOptions{MinRecords: 4, RejectBackwards: true}},
+	}})
+
+	code, report := ingest(t, engine, newIngestRequest("departures", readFixture(t, "first.txt"), "secret"))
+	require.Equal(http.StatusOK, code, report)
+
+	code, report = ingest(t, engine, newIngestRequest("departures", readFixture(t, "second.txt"), "secret"))
+	require.Equal(http.StatusUnprocessableEntity, code, report)
+	assert.False(report.Loaded)
+	require.NotNil(report.SanityRejection)
+	assert.Equal("min_records", report.SanityRejection.Check)
+	departures, err := manager.GetDeparturesByStops([]string{"3"})
+	require.Nil(err)
+	assert.Len(departures, 4)
+
+	// the pushed files have no modification time, they can't be compared
+	code, report = ingest(t, engine, newIngestRequest("departures", readFixture(t, "first.txt"), "secret"))
+	require.Equal(http.StatusOK, code, report)
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -74,11 +77,31 @@ func ParseDirectionTypeFromNavitia(value string) (DirectionType, error) {
 	}
 }
 
+// missingFieldError is returned for a record having less fields than expected
+type missingFieldError struct {
+	record string
+}
+
+func (e *missingFieldError) Error() string {
+	return "Missing field in " + e.record
+}
+
 type LineConsumer interface {
 	Consume([]string, *time.Location) error
 	Terminate()
 }
 
+// HeaderConsumer is implemented by the LineConsumers checking the header row of the files having one
+type HeaderConsumer interface {
+	ConsumeHeader([]string) error
+}
+
+// the default columns of the records, by index
+var (
+	defaultDepartureColumns = mustResolve(DepartureColumns, "record")
+	defaultParkingColumns   = mustResolve(ParkingColumns, "Parking record")
+)
+
 // Departure represent a departure for a public transport vehicle
 type Departure struct {
 	Line          string        `json:"line"`
@@ -88,46 +111,92 @@ type Departure struct {
 	DirectionName string        `json:"direction_name"`
 	Datetime      time.Time     `json:"datetime"`
 	DirectionType DirectionType `json:"direction_type,omitempty"`
-	//VJ            string
-	//Route         string
+	// VehicleJourney is the run of the vehicle serving the departure, the same at every stop it serves
+	VehicleJourney *VehicleJourney `json:"vehicle_journey,omitempty"`
+	Route          string          `json:"route,omitempty"`
+}
+
+// VehicleJourney identifies a run of a vehicle, like 87A-022AM:5:2:12.
+// Its components are empty if the identifier has another format.
+type VehicleJourney struct {
+	ID          string `json:"id"`
+	LineVariant string `json:"line_variant,omitempty"` // 87A-022AM
+	Course      string `json:"course,omitempty"`       // 5
+	Run         string `json:"run,omitempty"`          // 2
+	// Sequence is the last component of the identifier, it is the same at every stop of the run:
+	// it doesn't give the position of the stop
+	Sequence int `json:"sequence,omitempty"` // 12
+}
+
+// ParseVehicleJourney parses the identifier of a vehicle journey, it returns nil if it is empty
+func ParseVehicleJourney(value string) *VehicleJourney {
+	if value == "" {
+		return nil
+	}
+	vj := &VehicleJourney{ID: value}
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 || parts[0] == "" {
+		return vj
+	}
+	sequence, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return vj
+	}
+	vj.LineVariant, vj.Course, vj.Run, vj.Sequence = parts[0], parts[1], parts[2], sequence
+	return vj
 }
 
+// NewDeparture creates a departure from a record having the DepartureColumns
 func NewDeparture(record []string, location *time.Location) (Departure, error) {
-	if len(record) < 7 {
-		return Departure{}, fmt.Errorf("Missing field in record")
-	}
-	dt, err := time.ParseInLocation("2006-01-02 15:04:05", record[5], location)
+	return newDeparture(record, defaultDepartureColumns, location)
+}
+
+func newDeparture(record []string, columns columns, location *time.Location) (Departure, error) {
+	values, err := columns.values(record,
+		"stop", "line", "direction_name", "type", "direction", "direction_type", "vehicle_journey", "route")
 	if err != nil {
 		return Departure{}, err
 	}
-	var directionType DirectionType
-	if len(record) >= 10 {
-		directionType = ParseDirectionType(record[9])
+	dt, err := columns.date(record, "datetime", location)
+	if err != nil {
+		return Departure{}, err
 	}
 
 	return Departure{
-		Stop:          record[0],
-		Line:          record[1],
-		Type:          record[4],
-		Datetime:      dt,
-		Direction:     record[6],
-		DirectionName: record[2],
-		DirectionType: directionType,
+		Stop:           values[0],
+		Line:           values[1],
+		Type:           values[3],
+		Datetime:       dt,
+		Direction:      values[4],
+		DirectionName:  values[2],
+		DirectionType:  ParseDirectionType(values[5]),
+		VehicleJourney: ParseVehicleJourney(values[6]),
+		Route:          values[7],
 	}, nil
 }
 
 // DepartureLineConsumer constructs a departure from a slice of strings
 type DepartureLineConsumer struct {
-	data map[string][]Departure
+	data    map[string][]Departure
+	columns columns
 }
 
 func makeDepartureLineConsumer() *DepartureLineConsumer {
-	return &DepartureLineConsumer{make(map[string][]Departure)}
+	return &DepartureLineConsumer{make(map[string][]Departure), defaultDepartureColumns}
+}
+
+// newDepartureLineConsumer returns a consumer of the records whose columns differ from DepartureColumns for some fields
+func newDepartureLineConsumer(overrides ColumnMapping) (*DepartureLineConsumer, error) {
+	columns, err := resolveOverrides(DepartureColumns, overrides, "record", nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid departures columns: %s", err)
+	}
+	return &DepartureLineConsumer{make(map[string][]Departure), columns}, nil
 }
 
 func (p *DepartureLineConsumer) Consume(line []string, loc *time.Location) error {
 
-	departure, err := NewDeparture(line, loc)
+	departure, err := newDeparture(line, p.columns, loc)
 	if err != nil {
 		return err
 	}
@@ -162,36 +231,40 @@ func (p ByParkingId) Len() int           { return len(p) }
 func (p ByParkingId) Less(i, j int) bool { return p[i].ID < p[j].ID }
 func (p ByParkingId) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
-// NewParking creates a new Parking object based on a line read from a CSV
+// NewParking creates a new Parking object based on a line read from a CSV having the ParkingColumns
 func NewParking(record []string, location *time.Location) (*Parking, error) {
-	if len(record) < 8 {
-		return nil, fmt.Errorf("Missing field in Parking record")
-	}
+	return newParking(record, defaultParkingColumns, location)
+}
 
-	updatedTime, err := time.ParseInLocation("2006-01-02 15:04:05", record[2], location)
+func newParking(record []string, columns columns, location *time.Location) (*Parking, error) {
+	values, err := columns.values(record, "id", "label")
+	if err != nil {
+		return nil, err
+	}
+	updatedTime, err := columns.date(record, "updated_time", location)
 	if err != nil {
 		return nil, err
 	}
-	availableStd, err := strconv.Atoi(record[4])
+	availableStd, err := columns.int(record, "available_standard_spaces")
 	if err != nil {
 		return nil, err
 	}
-	totalStd, err := strconv.Atoi(record[5])
+	totalStd, err := columns.int(record, "total_standard_spaces")
 	if err != nil {
 		return nil, err
 	}
-	availableAcc, err := strconv.Atoi(record[6])
+	availableAcc, err := columns.int(record, "available_accessible_spaces")
 	if err != nil {
 		return nil, err
 	}
-	totalAcc, err := strconv.Atoi(record[7])
+	totalAcc, err := columns.int(record, "total_accessible_spaces")
 	if err != nil {
 		return nil, err
 	}
 
 	return &Parking{
-		ID:                        record[0],    // COD_PAR_REL
-		Label:                     record[1],    // LIB_PAR_REL
+		ID:                        values[0],    // COD_PAR_REL
+		Label:                     values[1],    // LIB_PAR_REL
 		UpdatedTime:               updatedTime,  // DATEHEURE_COMPTAGE
 		AvailableStandardSpaces:   availableStd, // NB_TOT_PLACE_DISPO
 		AvailableAccessibleSpaces: availableAcc, // NB_TOT_PLACE_PMR_DISPO
@@ -203,16 +276,44 @@ func NewParking(record []string, location *time.Location) (*Parking, error) {
 // ParkingLineConsumer constructs a parking from a slice of strings
 type ParkingLineConsumer struct {
 	parkings map[string]Parking
+	mapping  ColumnMapping
+	columns  columns
 }
 
 func makeParkingLineConsumer() *ParkingLineConsumer {
 	return &ParkingLineConsumer{
 		parkings: make(map[string]Parking),
+		mapping:  ParkingColumns,
+		columns:  defaultParkingColumns,
+	}
+}
+
+// newParkingLineConsumer returns a consumer of the records whose columns differ from ParkingColumns for some fields,
+// they are looked up in the header
+func newParkingLineConsumer(overrides ColumnMapping) (*ParkingLineConsumer, error) {
+	mapping, err := ParkingColumns.withOverrides(overrides)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parkings columns: %s", err)
+	}
+	return &ParkingLineConsumer{
+		parkings: make(map[string]Parking),
+		mapping:  mapping,
+		columns:  defaultParkingColumns,
+	}, nil
+}
+
+// ConsumeHeader finds the columns in the header, it fails if one of the required ones is missing
+func (p *ParkingLineConsumer) ConsumeHeader(header []string) error {
+	columns, err := p.mapping.resolve("Parking record", header)
+	if err != nil {
+		return fmt.Errorf("invalid parkings header: %s", err)
 	}
+	p.columns = columns
+	return nil
 }
 
 func (p *ParkingLineConsumer) Consume(line []string, loc *time.Location) error {
-	parking, err := NewParking(line, loc)
+	parking, err := newParking(line, p.columns, loc)
 	if err != nil {
 		return err
 	}
@@ -263,29 +364,34 @@ func EmbeddedType(s string) (string, error) {
 	}
 }
 
-// NewEquipmentDetail creates a new EquipmentDetail object from the object EquipementSource
+// NewEquipmentDetail creates a new EquipmentDetail object from the object EquipementSource.
+// Its errors are XMLPathError locating the invalid attribute, like @date_remise_service.
 func NewEquipmentDetail(es EquipementSource, updatedAt time.Time, location *time.Location) (*EquipmentDetail, error) {
 	start, err := time.ParseInLocation("2006-01-02", es.Start, location)
 	if err != nil {
-		return nil, err
+		return nil, &XMLPathError{Path: "@date_debut_indisponibilite", Err: err}
 	}
 
 	end, err := time.ParseInLocation("2006-01-02", es.End, location)
 	if err != nil {
-		return nil, err
+		return nil, &XMLPathError{Path: "@date_remise_service", Err: err}
 	}
 
 	hour, err := time.ParseInLocation("15:04:05", es.Hour, location)
 	if err != nil {
-		return nil, err
+		return nil, &XMLPathError{Path: "@heure_remise_service", Err: err}
 	}
 
 	// Add time part to end date
 	end = hour.AddDate(end.Year(), int(end.Month())-1, end.Day()-1)
+	if start.After(end) {
+		return nil, &XMLPathError{Path: "@date_debut_indisponibilite",
+			Err: fmt.Errorf("%s is after the return to service at %s", es.Start, end.Format("2006-01-02 15:04:05"))}
+	}
 
 	etype, err := EmbeddedType(es.Type)
 	if err != nil {
-		return nil, err
+		return nil, &XMLPathError{Path: "@type", Err: err}
 	}
 	now := time.Now()
 
@@ -302,26 +408,67 @@ func NewEquipmentDetail(es EquipementSource, updatedAt time.Time, location *time
 	}, nil
 }
 
+// DataManager holds the datasets currently served.
+// For each of them the last update is the last time the data changed,
+// and the last check the last time its source has been successfully polled, even if nothing changed.
 type DataManager struct {
 	departures          *map[string][]Departure
+	departuresFile      fileMetadata
 	lastDepartureUpdate time.Time
+	lastDepartureCheck  time.Time
 	departuresMutex     sync.RWMutex
 
 	parkings          *map[string]Parking
+	parkingsFile      fileMetadata
 	lastParkingUpdate time.Time
+	lastParkingCheck  time.Time
 	parkingsMutex     sync.RWMutex
 
 	equipments          *[]EquipmentDetail
+	equipmentsFile      fileMetadata
 	lastEquipmentUpdate time.Time
+	lastEquipmentCheck  time.Time
 	equipmentsMutex     sync.RWMutex
+
+	feeds      map[string]*feedState
+	feedsMutex sync.RWMutex
+}
+
+// feedState holds how a feed is refreshed, besides its data
+type feedState struct {
+	breaker    *CircuitBreaker
+	mirrors    []url.URL
+	archiveDir string
+	rejections *RejectionReport
+	sanity     *SanityRejection // of the last dataset if it failed a sanity check
 }
 
 func (d *DataManager) UpdateDepartures(departures map[string][]Departure) {
+	d.updateDepartures(departures, fileMetadata{})
+}
+
+func (d *DataManager) updateDepartures(departures map[string][]Departure, file fileMetadata) {
 	d.departuresMutex.Lock()
 	defer d.departuresMutex.Unlock()
 
 	d.departures = &departures
+	d.departuresFile = file
 	d.lastDepartureUpdate = time.Now()
+	d.lastDepartureCheck = d.lastDepartureUpdate
+}
+
+func (d *DataManager) setDeparturesChecked() {
+	d.departuresMutex.Lock()
+	defer d.departuresMutex.Unlock()
+
+	d.lastDepartureCheck = time.Now()
+}
+
+func (d *DataManager) getDeparturesFile() fileMetadata {
+	d.departuresMutex.RLock()
+	defer d.departuresMutex.RUnlock()
+
+	return d.departuresFile
 }
 
 func (d *DataManager) GetLastDepartureDataUpdate() time.Time {
@@ -331,6 +478,13 @@ func (d *DataManager) GetLastDepartureDataUpdate() time.Time {
 	return d.lastDepartureUpdate
 }
 
+func (d *DataManager) GetLastDepartureDataCheck() time.Time {
+	d.departuresMutex.RLock()
+	defer d.departuresMutex.RUnlock()
+
+	return d.lastDepartureCheck
+}
+
 func (d *DataManager) GetDeparturesByStops(stopsID []string) ([]Departure, error) {
 	return d.GetDeparturesByStopsAndDirectionType(stopsID, DirectionTypeBoth)
 }
@@ -380,11 +534,31 @@ func filterDeparturesByDirectionType(departures []Departure, directionType Direc
 }
 
 func (d *DataManager) UpdateParkings(parkings map[string]Parking) {
+	d.updateParkings(parkings, fileMetadata{})
+}
+
+func (d *DataManager) updateParkings(parkings map[string]Parking, file fileMetadata) {
 	d.parkingsMutex.Lock()
 	defer d.parkingsMutex.Unlock()
 
 	d.parkings = &parkings
+	d.parkingsFile = file
 	d.lastParkingUpdate = time.Now()
+	d.lastParkingCheck = d.lastParkingUpdate
+}
+
+func (d *DataManager) setParkingsChecked() {
+	d.parkingsMutex.Lock()
+	defer d.parkingsMutex.Unlock()
+
+	d.lastParkingCheck = time.Now()
+}
+
+func (d *DataManager) getParkingsFile() fileMetadata {
+	d.parkingsMutex.RLock()
+	defer d.parkingsMutex.RUnlock()
+
+	return d.parkingsFile
 }
 
 func (d *DataManager) GetLastParkingsDataUpdate() time.Time {
@@ -394,6 +568,13 @@ func (d *DataManager) GetLastParkingsDataUpdate() time.Time {
 	return d.lastParkingUpdate
 }
 
+func (d *DataManager) GetLastParkingsDataCheck() time.Time {
+	d.parkingsMutex.RLock()
+	defer d.parkingsMutex.RUnlock()
+
+	return d.lastParkingCheck
+}
+
 func (d *DataManager) GetParkingsByIds(ids []string) (parkings []Parking, errors []error) {
 	for _, id := range ids {
 		if p, err := d.GetParkingById(id); err == nil {
@@ -451,11 +632,31 @@ func (d *DataManager) GetParkingById(id string) (p Parking, e error) {
 }
 
 func (d *DataManager) UpdateEquipments(equipments []EquipmentDetail) {
+	d.updateEquipments(equipments, fileMetadata{})
+}
+
+func (d *DataManager) updateEquipments(equipments []EquipmentDetail, file fileMetadata) {
 	d.equipmentsMutex.Lock()
 	defer d.equipmentsMutex.Unlock()
 
 	d.equipments = &equipments
+	d.equipmentsFile = file
 	d.lastEquipmentUpdate = time.Now()
+	d.lastEquipmentCheck = d.lastEquipmentUpdate
+}
+
+func (d *DataManager) setEquipmentsChecked() {
+	d.equipmentsMutex.Lock()
+	defer d.equipmentsMutex.Unlock()
+
+	d.lastEquipmentCheck = time.Now()
+}
+
+func (d *DataManager) getEquipmentsFile() fileMetadata {
+	d.equipmentsMutex.RLock()
+	defer d.equipmentsMutex.RUnlock()
+
+	return d.equipmentsFile
 }
 
 func (d *DataManager) GetLastEquipmentsDataUpdate() time.Time {
@@ -465,6 +666,13 @@ func (d *DataManager) GetLastEquipmentsDataUpdate() time.Time {
 	return d.lastEquipmentUpdate
 }
 
+func (d *DataManager) GetLastEquipmentsDataCheck() time.Time {
+	d.equipmentsMutex.RLock()
+	defer d.equipmentsMutex.RUnlock()
+
+	return d.lastEquipmentCheck
+}
+
 func (d *DataManager) GetEquipments() (equipments []EquipmentDetail, e error) {
 	var equipmentDetails []EquipmentDetail
 	{
@@ -482,6 +690,106 @@ func (d *DataManager) GetEquipments() (equipments []EquipmentDetail, e error) {
 	return equipmentDetails, nil
 }
 
+// feed returns the state of a feed, feedsMutex must be locked
+func (d *DataManager) feed(name string) *feedState {
+	if d.feeds == nil {
+		d.feeds = make(map[string]*feedState)
+	}
+	if _, ok := d.feeds[name]; !ok {
+		d.feeds[name] = &feedState{}
+	}
+	return d.feeds[name]
+}
+
+// SetBreaker registers the circuit breaker refreshing a feed, its state is then exposed by /status
+func (d *DataManager) SetBreaker(feed string, breaker *CircuitBreaker) {
+	d.feedsMutex.Lock()
+	defer d.feedsMutex.Unlock()
+
+	d.feed(feed).breaker = breaker
+}
+
+func (d *DataManager) setMirrors(feed string, mirrors []url.URL) {
+	d.feedsMutex.Lock()
+	defer d.feedsMutex.Unlock()
+
+	d.feed(feed).mirrors = mirrors
+}
+
+func (d *DataManager) setArchiveDir(feed string, dir string) {
+	d.feedsMutex.Lock()
+	defer d.feedsMutex.Unlock()
+
+	d.feed(feed).archiveDir = dir
+}
+
+// GetArchives lists the archived files of every feed having an archive directory
+func (d *DataManager) GetArchives() (map[string][]ArchivedFile, error) {
+	d.feedsMutex.RLock()
+	defer d.feedsMutex.RUnlock()
+
+	archives := make(map[string][]ArchivedFile)
+	for name, feed := range d.feeds {
+		if feed.archiveDir == "" {
+			continue
+		}
+		files, err := ListArchive(feed.archiveDir)
+		if os.IsNotExist(err) {
+			// nothing has been archived yet
+			files, err = nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the %s archive: %s", name, err)
+		}
+		if files == nil {
+			files = []ArchivedFile{}
+		}
+		archives[name] = files
+	}
+	return archives, nil
+}
+
+// getFeedFile returns the metadata of the file currently loaded for a feed
+func (d *DataManager) getFeedFile(feed string) fileMetadata {
+	switch feed {
+	case "departures":
+		return d.getDeparturesFile()
+	case "parkings":
+		return d.getParkingsFile()
+	case "equipments":
+		return d.getEquipmentsFile()
+	default:
+		return fileMetadata{}
+	}
+}
+
+// GetFeedsStatus returns how the refresh of each feed is going
+func (d *DataManager) GetFeedsStatus() map[string]FeedStatus {
+	d.feedsMutex.RLock()
+	defer d.feedsMutex.RUnlock()
+
+	if len(d.feeds) == 0 {
+		return nil
+	}
+	feeds := make(map[string]FeedStatus, len(d.feeds))
+	for name, feed := range d.feeds {
+		var status FeedStatus
+		if feed.breaker != nil {
+			breakerStatus := feed.breaker.Status()
+			status.Breaker = &breakerStatus
+		}
+		for _, mirror := range feed.mirrors {
+			status.Mirrors = append(status.Mirrors, mirrors.status(mirror))
+		}
+		status.SanityRejection = feed.sanity
+		if uri, err := url.Parse(d.getFeedFile(name).uri); err == nil && uri.String() != "" {
+			status.Source = RedactURI(*uri)
+		}
+		feeds[name] = status
+	}
+	return feeds
+}
+
 // GetEquipmentStatus returns availability of equipment
 func GetEquipmentStatus(start time.Time, end time.Time, now time.Time) string {
 	if now.Before(start) || now.After(end) {
@@ -2,6 +2,7 @@ package sytralrt
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -72,6 +73,62 @@ func TestNewDepartureWithDirectionType(t *testing.T) {
 	assert.Equal(time.Date(2018, 9, 17, 20, 28, 0, 0, location), d.Datetime)
 }
 
+func TestNewDepartureWithVehicleJourney(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	location, err := time.LoadLocation("Europe/Paris")
+	require.Nil(err)
+
+	d, err := NewDeparture([]string{"1", "87A", "Mions Bourdelle", "11 min", "E", "2018-09-17 20:28:00", "35998",
+		"87A-022AM:5:2:12", "1", "ALL"}, location)
+	require.Nil(err)
+	assert.Equal(&VehicleJourney{ID: "87A-022AM:5:2:12", LineVariant: "87A-022AM", Course: "5", Run: "2", Sequence: 12},
+		d.VehicleJourney)
+	assert.Equal("1", d.Route)
+
+	encoded, err := json.Marshal(d)
+	require.Nil(err)
+	assert.Contains(string(encoded), `"vehicle_journey":{"id":"87A-022AM:5:2:12","line_variant":"87A-022AM",`+
+		`"course":"5","run":"2","sequence":12},"route":"1"`)
+
+	// the files without these columns are still loaded
+	d, err = NewDeparture([]string{"1", "2", "dest", "", "E", "2018-09-17 20:28:00", "3"}, location)
+	require.Nil(err)
+	assert.Nil(d.VehicleJourney)
+	assert.Empty(d.Route)
+	encoded, err = json.Marshal(d)
+	require.Nil(err)
+	assert.NotContains(string(encoded), "vehicle_journey")
+}
+
+func TestParseVehicleJourney(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(ParseVehicleJourney(""))
+	assert.Equal(&VehicleJourney{ID: "C20A-062BT:12:1:21", LineVariant: "C20A-062BT", Course: "12", Run: "1",
+		Sequence: 21}, ParseVehicleJourney("C20A-062BT:12:1:21"))
+	// the identifiers having another format are kept as they are
+	assert.Equal(&VehicleJourney{ID: "vjid"}, ParseVehicleJourney("vjid"))
+	assert.Equal(&VehicleJourney{ID: "87A-022AM:5:2:x"}, ParseVehicleJourney("87A-022AM:5:2:x"))
+}
+
+func TestVehicleJourneyAtEveryStop(t *testing.T) {
+	departures, err := loadDepartures(bytes.NewReader(readFixture(t, "extract_edylic.txt")), defaultOptions, nil)
+	require.Nil(t, err)
+	// the last component of the identifier doesn't change from a stop to another
+	for _, stop := range []string{"3", "48", "159", "367", "463"} {
+		var vj *VehicleJourney
+		for _, d := range departures[stop] {
+			if d.VehicleJourney != nil && d.VehicleJourney.ID == "C20A-062BT:7:1:28" {
+				vj = d.VehicleJourney
+			}
+		}
+		require.NotNil(t, vj, stop)
+		assert.Equal(t, 28, vj.Sequence, stop)
+	}
+}
+
 func TestNewDepartureMissingField(t *testing.T) {
 	require := require.New(t)
 	location, err := time.LoadLocation("Europe/Paris")
@@ -0,0 +1,88 @@
+package sytralrt
+
+import (
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// FileWatcher notifies when the file of a file source is written or atomically replaced
+type FileWatcher struct {
+	// C receives a value once the files have stopped changing for the debounce delay,
+	// the notifications made while nobody is receiving are merged
+	C <-chan struct{}
+
+	watcher *fsnotify.Watcher
+}
+
+// NewFileWatcher watches the files of the file uris, other schemes are ignored.
+// The directories are watched rather than the files so that a file renamed over the watched one is seen.
+func NewFileWatcher(uris []url.URL, debounce time.Duration) (*FileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	dirs := make(map[string]bool)
+	for _, uri := range uris {
+		if uri.Scheme != "file" {
+			continue
+		}
+		pattern := filepath.Clean(uri.Path)
+		patterns = append(patterns, pattern)
+		if dir := filepath.Dir(pattern); !dirs[dir] {
+			if err := watcher.Add(dir); err != nil {
+				watcher.Close()
+				return nil, err
+			}
+			dirs[dir] = true
+		}
+	}
+
+	c := make(chan struct{}, 1)
+	go watchEvents(watcher, patterns, debounce, c)
+	return &FileWatcher{C: c, watcher: watcher}, nil
+}
+
+func (w *FileWatcher) Close() error {
+	return w.watcher.Close()
+}
+
+func watchEvents(watcher *fsnotify.Watcher, patterns []string, debounce time.Duration, c chan<- struct{}) {
+	var fire <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// a renamed file shows up as created under its new name
+			if event.Op&(fsnotify.Write|fsnotify.Create) != 0 && matchesAny(patterns, event.Name) {
+				fire = time.After(debounce)
+			}
+		case <-fire:
+			fire = nil
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logrus.Warnf("error while watching files: %s", err)
+		}
+	}
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}